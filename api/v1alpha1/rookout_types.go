@@ -11,12 +11,94 @@ import (
 // make sure to run "make deployment_yamls" after everytime you change this file
 // !!!!!!!!!!
 
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;DaemonSet;CronJob;Job
+type WorkloadKind string
+
+const (
+	DeploymentKind  WorkloadKind = "Deployment"
+	StatefulSetKind WorkloadKind = "StatefulSet"
+	DaemonSetKind   WorkloadKind = "DaemonSet"
+	CronJobKind     WorkloadKind = "CronJob"
+	// Job pod templates are immutable, jobs are only instrumented on creation (by the admission webhook)
+	JobKind WorkloadKind = "Job"
+)
+
+// +kubebuilder:validation:Enum=Java;Python;Node;DotNet;Auto
+type Runtime string
+
+const (
+	JavaRuntime   Runtime = "Java"
+	PythonRuntime Runtime = "Python"
+	NodeRuntime   Runtime = "Node"
+	DotNetRuntime Runtime = "DotNet"
+	// Detects each container's runtime (annotations, command, env vars and image), undetected containers are skipped
+	AutoRuntime Runtime = "Auto"
+)
+
+// TokenSecretRef references the Secret holding the Rookout token, injected as ROOKOUT_TOKEN using valueFrom.secretKeyRef
+type TokenSecretRef struct {
+	// Name of the Secret, in the configuration's namespace
+	Name string `json:"name"`
+	// Key of the token in the Secret, "token" when empty
+	Key string `json:"key,omitempty"`
+	// Copies the Secret to the namespace of every matched workload, since pods can only reference Secrets in their
+	// own namespace. Otherwise a Secret with the same name and key must exist in every matched namespace
+	CopyToNamespaces bool `json:"copy_to_namespaces,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=Contains;Exact;Prefix;Glob;Regex
+type MatchMode string
+
+const (
+	// The name contains the value
+	ContainsMatchMode MatchMode = "Contains"
+	ExactMatchMode    MatchMode = "Exact"
+	PrefixMatchMode   MatchMode = "Prefix"
+	// Shell pattern (*, ?, [a-z]) matched against the whole name
+	GlobMatchMode MatchMode = "Glob"
+	// Regular expression (RE2 syntax) matched against the whole name
+	RegexMatchMode MatchMode = "Regex"
+)
+
 type Matcher struct {
-	Container  string            `json:"container,omitempty"`
+	// Identifies the matcher in logs, annotations and status, its index (#0, #1...) when empty
+	Name string `json:"name,omitempty"`
+	// Matchers with a higher priority are evaluated first, matchers with the same priority in order.
+	// The first matcher matching a container decides whether it is instrumented
+	Priority int32 `json:"priority,omitempty"`
+	// Containers matched by an exclude matcher are not instrumented by this configuration
+	Exclude bool `json:"exclude,omitempty"`
+
+	Container string `json:"container,omitempty"`
+	// Matched against the workload name, whatever its kind is
 	Deployment string            `json:"deployment,omitempty"`
 	Labels     map[string]string `json:"labels,omitempty"`
 	EnvVars    []v1.EnvVar       `json:"env_vars,omitempty"`
 	Namespace  string            `json:"namespace,omitempty"`
+	// Matched against the container's image repository (without tag or digest), like registry/payments/api
+	Image string `json:"image,omitempty"`
+	// Matched against the container's image tag ("latest" when the image has neither a tag nor a digest)
+	ImageTag string `json:"image_tag,omitempty"`
+	// How the container, deployment, namespace, image and image_tag fields are matched, Contains when empty
+	ContainerMatchMode  MatchMode `json:"container_match_mode,omitempty"`
+	DeploymentMatchMode MatchMode `json:"deployment_match_mode,omitempty"`
+	NamespaceMatchMode  MatchMode `json:"namespace_match_mode,omitempty"`
+	ImageMatchMode      MatchMode `json:"image_match_mode,omitempty"`
+	ImageTagMatchMode   MatchMode `json:"image_tag_match_mode,omitempty"`
+	// Kinds of workloads this matcher applies to, Deployment only when empty
+	WorkloadKinds []WorkloadKind `json:"workload_kinds,omitempty"`
+	// Runtime of the matched containers, Java when empty
+	Runtime Runtime `json:"runtime,omitempty"`
+	// Used instead of a ROOKOUT_TOKEN env var
+	TokenSecretRef *TokenSecretRef `json:"token_secret_ref,omitempty"`
+	// Selects workloads by their labels, combined (ANDed) with labels
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Selects workloads by the labels of their namespace, combined (ANDed) with namespace
+	NamespaceSelector *metav1.LabelSelector `json:"namespace_selector,omitempty"`
+	// Selects workloads by the labels of their pod template
+	PodSelector *metav1.LabelSelector `json:"pod_selector,omitempty"`
+	// Annotations (and values) the workload's pod template must have
+	PodAnnotations map[string]string `json:"pod_annotations,omitempty"`
 }
 
 type InitContainer struct {
@@ -27,21 +109,138 @@ type InitContainer struct {
 	SharedVolumeName      string        `json:"shared_volume_name,omitempty"`
 }
 
+// +kubebuilder:validation:Enum=Workload;Pod
+type InjectionMode string
+
+const (
+	// The operator patches the pod template of matching workloads (triggers a rollout)
+	WorkloadInjectionMode InjectionMode = "Workload"
+	// The agent is added to pods when they are created by the admission webhook, workloads are left untouched
+	PodInjectionMode InjectionMode = "Pod"
+)
+
+// +kubebuilder:validation:Enum=Cluster;Namespace
+type ConfigurationScope string
+
+const (
+	// The configuration's matchers apply to workloads in every namespace, only allowed in the namespaces the operator
+	// trusts with it (--cluster-scope-namespaces)
+	ClusterScope ConfigurationScope = "Cluster"
+	// The configuration only applies to workloads in its own namespace
+	NamespaceScope ConfigurationScope = "Namespace"
+)
+
+// +kubebuilder:validation:Enum=Disabled;OptOut;Override
+type AnnotationPolicy string
+
+const (
+	// Workload annotations are ignored
+	DisabledAnnotationPolicy AnnotationPolicy = "Disabled"
+	// Annotations can only narrow what the matchers instrument (rookout.com/inject: "false", rookout.com/containers)
+	// and add env vars to instrumented containers
+	OptOutAnnotationPolicy AnnotationPolicy = "OptOut"
+	// Annotations can also instrument workloads and containers no matcher selected (rookout.com/inject: "true"),
+	// using the settings of the configuration's first matcher (by priority)
+	OverrideAnnotationPolicy AnnotationPolicy = "Override"
+)
+
+// +kubebuilder:validation:Enum=Apply;DryRun
+type OperatorMode string
+
+const (
+	// Workloads are patched
+	ApplyOperatorMode OperatorMode = "Apply"
+	// Workloads are never patched, the patches the operator would send are reported in the configuration's status
+	DryRunOperatorMode OperatorMode = "DryRun"
+)
+
+// Limits how many workloads roll out (because the operator patched them) at the same time
+type RolloutPolicy struct {
+	// Maximum number of workloads rolling out at the same time, unlimited when 0
+	MaxConcurrent int32 `json:"max_concurrent,omitempty"`
+	// A patched workload keeps rolling out until all its replicas are updated and available, otherwise only until its
+	// controller observed the patch
+	WaitForAvailable bool `json:"wait_for_available,omitempty"`
+	// Stop patching workloads while the rollout of a patched workload failed (its progress deadline was exceeded)
+	PauseOnFailure bool `json:"pause_on_failure,omitempty"`
+}
+
 // RookoutSpec defines the desired state of Rookout
 type RookoutSpec struct {
 	Matchers      []Matcher     `json:"matchers,omitempty"`
 	InitContainer InitContainer `json:"init_container,omitempty"`
 	RequeueAfter  time.Duration `json:"requeue_after,omitempty"`
+	// Workload when empty, Pod requires the webhooks to be enabled
+	InjectionMode InjectionMode `json:"injection_mode,omitempty"`
+	// Namespace when empty. Cluster is only allowed for configurations in the namespaces given to the operator with
+	// --cluster-scope-namespaces (its own namespace by default), and never when it is restricted to a set of namespaces
+	Scope ConfigurationScope `json:"scope,omitempty"`
+	// Whether workload annotations can override the matchers, OptOut when empty
+	AnnotationPolicy AnnotationPolicy `json:"annotation_policy,omitempty"`
+	// Apply when empty, always DryRun when the operator runs with --dry-run
+	Mode OperatorMode `json:"mode,omitempty"`
+	// All matching workloads are patched at once when not set
+	RolloutPolicy *RolloutPolicy `json:"rollout_policy,omitempty"`
+}
+
+const (
+	// The configuration is valid and the operator is syncing workloads with it
+	ReadyCondition = "Ready"
+	// Set once the configuration is deleted, while the agent is removed from the workloads it patched
+	CleanupCondition = "Cleanup"
+)
+
+type WorkloadStatus struct {
+	Kind      WorkloadKind `json:"kind"`
+	Namespace string       `json:"namespace"`
+	Name      string       `json:"name"`
+	// The matcher which won for every instrumented container (container=matcher)
+	Matchers string `json:"matchers,omitempty"`
+	// Why syncing the workload failed
+	Message string `json:"message,omitempty"`
+	// The JSON patch (RFC 6902) the operator would send, in dry run mode. Truncated when longer than 4KiB, the full patch
+	// is in the operator's logs
+	Patch string `json:"patch,omitempty"`
 }
 
 // RookoutStatus defines the observed state of Rookout
 type RookoutStatus struct {
-	// TODO: consider using this objet to represent our operator state
-	// Instead of the internal struct
+	// The generation of the spec the operator is currently configured with
+	ObservedGeneration int64              `json:"observed_generation,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+
+	MatchedCount int `json:"matched_count"`
+	PatchedCount int `json:"patched_count"`
+	FailedCount  int `json:"failed_count"`
+	// Workloads with at least one container matching the configuration. Like every list of workloads in the status,
+	// only the first 100 are listed, the count next to the list has them all
+	MatchedWorkloads []WorkloadStatus `json:"matched_workloads,omitempty"`
+	// Workloads which currently have the agent injected into their pod template
+	PatchedWorkloads []WorkloadStatus `json:"patched_workloads,omitempty"`
+	// Workloads the operator failed to patch or unpatch on their last sync
+	FailedWorkloads []WorkloadStatus `json:"failed_workloads,omitempty"`
+	// Once the configuration is deleted, the number of workloads it patched which still have the agent
+	CleanupPendingCount int `json:"cleanup_pending_count,omitempty"`
+	// In dry run mode, the number of workloads the operator would patch (or unpatch)
+	DryRunCount int `json:"dry_run_count,omitempty"`
+	// In dry run mode, the workloads the operator would patch (or unpatch) with their patch
+	DryRunWorkloads []WorkloadStatus `json:"dry_run_workloads,omitempty"`
+	PendingCount    int              `json:"pending_count,omitempty"`
+	// Workloads waiting for the rollout policy to be patched (with the reason)
+	PendingWorkloads []WorkloadStatus `json:"pending_workloads,omitempty"`
+	QuarantinedCount int              `json:"quarantined_count,omitempty"`
+	// Workloads the agent was removed from since they became unhealthy once patched (with the reason), they aren't
+	// patched again until their rookout.com/quarantined annotation is removed
+	QuarantinedWorkloads []WorkloadStatus `json:"quarantined_workloads,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Matched",type=integer,JSONPath=`.status.matched_count`
+// +kubebuilder:printcolumn:name="Patched",type=integer,JSONPath=`.status.patched_count`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed_count`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Rookout is the Schema for the rookouts API
 type Rookout struct {
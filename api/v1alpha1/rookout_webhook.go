@@ -0,0 +1,224 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+const (
+	RookoutEnvVarPrefix         = "ROOKOUT_"
+	RookoutTokenEnvVar          = "ROOKOUT_TOKEN"
+	RookoutControllerHostEnvVar = "ROOKOUT_CONTROLLER_HOST"
+)
+
+var supportedPullPolicies = []string{string(v1.PullAlways), string(v1.PullIfNotPresent), string(v1.PullNever)}
+
+func (r *Rookout) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-rookout-rookout-com-v1alpha1-rookout,mutating=false,failurePolicy=fail,sideEffects=None,groups=rookout.rookout.com,resources=rookouts,verbs=create;update,versions=v1alpha1,name=vrookout.rookout.com,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &Rookout{}
+
+func (r *Rookout) ValidateCreate() error {
+	return r.validate()
+}
+
+func (r *Rookout) ValidateUpdate(old runtime.Object) error {
+	return r.validate()
+}
+
+func (r *Rookout) ValidateDelete() error {
+	return nil
+}
+
+func (r *Rookout) validate() error {
+	errs := r.Spec.Validate(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("Rookout").GroupKind(), r.Name, errs)
+}
+
+// Validate returns every problem found in the spec, with the path of the field causing it
+func (s *RookoutSpec) Validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	matchersPath := fldPath.Child("matchers")
+	if len(s.Matchers) == 0 {
+		errs = append(errs, field.Required(matchersPath, "at least one matcher is required"))
+	}
+
+	matcherNames := map[string]bool{}
+	for i, matcher := range s.Matchers {
+		errs = append(errs, matcher.Validate(matchersPath.Index(i))...)
+
+		if matcher.Name != "" {
+			if matcherNames[matcher.Name] {
+				errs = append(errs, field.Duplicate(matchersPath.Index(i).Child("name"), matcher.Name))
+			}
+			matcherNames[matcher.Name] = true
+		}
+	}
+
+	errs = append(errs, s.InitContainer.Validate(fldPath.Child("init_container"))...)
+
+	if s.RequeueAfter < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("requeue_after"), s.RequeueAfter, "must not be negative"))
+	}
+
+	if s.RolloutPolicy != nil && s.RolloutPolicy.MaxConcurrent < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("rollout_policy", "max_concurrent"), s.RolloutPolicy.MaxConcurrent, "must not be negative"))
+	}
+
+	return errs
+}
+
+func (m *Matcher) Validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	envVarsPath := fldPath.Child("env_vars")
+	for i, envVar := range m.EnvVars {
+		if !strings.HasPrefix(envVar.Name, RookoutEnvVarPrefix) {
+			errs = append(errs, field.Invalid(envVarsPath.Index(i).Child("name"), envVar.Name, fmt.Sprintf("only env vars with %s prefix are allowed", RookoutEnvVarPrefix)))
+		}
+	}
+
+	// Exclude matchers never inject the agent
+	if !m.Exclude && !m.HasRookoutConnection() {
+		errs = append(errs, field.Required(envVarsPath, fmt.Sprintf("%s, token_secret_ref (or %s, when using a deployed Rookout controller) is required", RookoutTokenEnvVar, RookoutControllerHostEnvVar)))
+	}
+
+	if m.TokenSecretRef != nil {
+		errs = append(errs, m.TokenSecretRef.Validate(fldPath.Child("token_secret_ref"))...)
+
+		for i, envVar := range m.EnvVars {
+			if envVar.Name == RookoutTokenEnvVar {
+				errs = append(errs, field.Invalid(envVarsPath.Index(i).Child("name"), envVar.Name, "token is already set by token_secret_ref"))
+			}
+		}
+	}
+
+	errs = append(errs, metav1validation.ValidateLabels(m.Labels, fldPath.Child("labels"))...)
+	errs = append(errs, metav1validation.ValidateLabelSelector(m.Selector, fldPath.Child("selector"))...)
+	errs = append(errs, metav1validation.ValidateLabelSelector(m.NamespaceSelector, fldPath.Child("namespace_selector"))...)
+	errs = append(errs, validatePattern(m.Container, m.ContainerMatchMode, fldPath.Child("container"))...)
+	errs = append(errs, validatePattern(m.Deployment, m.DeploymentMatchMode, fldPath.Child("deployment"))...)
+	errs = append(errs, validatePattern(m.Namespace, m.NamespaceMatchMode, fldPath.Child("namespace"))...)
+	errs = append(errs, validatePattern(m.Image, m.ImageMatchMode, fldPath.Child("image"))...)
+	errs = append(errs, validatePattern(m.ImageTag, m.ImageTagMatchMode, fldPath.Child("image_tag"))...)
+	errs = append(errs, metav1validation.ValidateLabelSelector(m.PodSelector, fldPath.Child("pod_selector"))...)
+
+	return errs
+}
+
+// HasRookoutConnection is true when the matcher's env vars (or token secret) tell the agent which Rookout controller to connect to
+func (m *Matcher) HasRookoutConnection() bool {
+	if m.TokenSecretRef != nil {
+		return true
+	}
+
+	for _, envVar := range m.EnvVars {
+		if envVar.Name == RookoutTokenEnvVar || envVar.Name == RookoutControllerHostEnvVar {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (i *InitContainer) Validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if i.ImagePullPolicy != "" && !sets.NewString(supportedPullPolicies...).Has(string(i.ImagePullPolicy)) {
+		errs = append(errs, field.NotSupported(fldPath.Child("image_pull_policy"), i.ImagePullPolicy, supportedPullPolicies))
+	}
+
+	if i.ContainerName != "" {
+		for _, msg := range validation.IsDNS1123Label(i.ContainerName) {
+			errs = append(errs, field.Invalid(fldPath.Child("container_name"), i.ContainerName, msg))
+		}
+	}
+
+	if i.SharedVolumeName != "" {
+		for _, msg := range validation.IsDNS1123Label(i.SharedVolumeName) {
+			errs = append(errs, field.Invalid(fldPath.Child("shared_volume_name"), i.SharedVolumeName, msg))
+		}
+	}
+
+	if i.SharedVolumeMountPath != "" && !strings.HasPrefix(i.SharedVolumeMountPath, "/") {
+		errs = append(errs, field.Invalid(fldPath.Child("shared_volume_mount_path"), i.SharedVolumeMountPath, "must be an absolute path"))
+	}
+
+	return errs
+}
+
+func (r *TokenSecretRef) Validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if r.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("name"), "secret name is required"))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(r.Name) {
+			errs = append(errs, field.Invalid(fldPath.Child("name"), r.Name, msg))
+		}
+	}
+
+	if r.Key != "" {
+		for _, msg := range validation.IsConfigMapKey(r.Key) {
+			errs = append(errs, field.Invalid(fldPath.Child("key"), r.Key, msg))
+		}
+	}
+
+	return errs
+}
+
+// Makes sure glob and regex patterns can be compiled
+func validatePattern(pattern string, mode MatchMode, fldPath *field.Path) field.ErrorList {
+	var err error
+
+	switch mode {
+	case GlobMatchMode:
+		_, err = path.Match(pattern, "")
+	case RegexMatchMode:
+		_, err = regexp.Compile(pattern)
+	}
+
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, pattern, err.Error())}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateSpec(t *testing.T) {
+	assert := require.New(t)
+
+	validSpec := RookoutSpec{
+		Matchers: []Matcher{{EnvVars: []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}}}},
+	}
+	assert.Empty(validSpec.Validate(field.NewPath("spec")))
+
+	assert.Equal("spec.matchers", RookoutSpec{}.validateFields()[0])
+
+	invalidSpec := RookoutSpec{
+		Matchers: []Matcher{
+			{
+				EnvVars: []v1.EnvVar{{Name: "TOKEN", Value: "token"}},
+				Labels:  map[string]string{"app": "not a valid value"},
+			},
+		},
+		InitContainer: InitContainer{ImagePullPolicy: "Sometimes", SharedVolumeName: "/rookout"},
+	}
+	assert.Equal([]string{
+		"spec.matchers[0].env_vars[0].name",
+		"spec.matchers[0].env_vars",
+		"spec.matchers[0].labels",
+		"spec.init_container.image_pull_policy",
+		"spec.init_container.shared_volume_name",
+	}, invalidSpec.validateFields())
+
+	rookout := Rookout{Spec: invalidSpec}
+	assert.Error(rookout.ValidateCreate())
+}
+
+func TestValidateTokenSecretRef(t *testing.T) {
+	assert := require.New(t)
+
+	validSpec := RookoutSpec{
+		Matchers: []Matcher{{TokenSecretRef: &TokenSecretRef{Name: "rookout-token"}}},
+	}
+	assert.Empty(validSpec.Validate(field.NewPath("spec")))
+
+	invalidSpec := RookoutSpec{
+		Matchers: []Matcher{
+			{
+				EnvVars:        []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}},
+				TokenSecretRef: &TokenSecretRef{Name: "Rookout_Token", Key: "a/b"},
+			},
+		},
+	}
+	assert.Equal([]string{
+		"spec.matchers[0].token_secret_ref.name",
+		"spec.matchers[0].token_secret_ref.key",
+		"spec.matchers[0].env_vars[0].name",
+	}, invalidSpec.validateFields())
+}
+
+func TestValidateMatchModes(t *testing.T) {
+	assert := require.New(t)
+
+	spec := RookoutSpec{
+		Matchers: []Matcher{
+			{
+				EnvVars:             []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}},
+				Container:           "[",
+				ContainerMatchMode:  GlobMatchMode,
+				Deployment:          "api-(",
+				DeploymentMatchMode: RegexMatchMode,
+				Namespace:           "team-(",
+			},
+		},
+	}
+	assert.Equal([]string{
+		"spec.matchers[0].container",
+		"spec.matchers[0].deployment",
+	}, spec.validateFields())
+}
+
+func TestValidateMatcherNames(t *testing.T) {
+	assert := require.New(t)
+
+	spec := RookoutSpec{
+		Matchers: []Matcher{
+			{Name: "team", EnvVars: []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}}},
+			// Exclude matchers don't need a token
+			{Name: "team", Exclude: true, Priority: 1},
+		},
+	}
+	assert.Equal([]string{"spec.matchers[1].name"}, spec.validateFields())
+}
+
+func (s RookoutSpec) validateFields() []string {
+	var fields []string
+	for _, err := range s.Validate(field.NewPath("spec")) {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
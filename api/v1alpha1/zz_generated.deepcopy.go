@@ -22,6 +22,7 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -57,6 +58,38 @@ func (in *Matcher) DeepCopyInto(out *Matcher) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.WorkloadKinds != nil {
+		in, out := &in.WorkloadKinds, &out.WorkloadKinds
+		*out = make([]WorkloadKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.TokenSecretRef != nil {
+		in, out := &in.TokenSecretRef, &out.TokenSecretRef
+		*out = new(TokenSecretRef)
+		**out = **in
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodAnnotations != nil {
+		in, out := &in.PodAnnotations, &out.PodAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Matcher.
@@ -75,7 +108,7 @@ func (in *Rookout) DeepCopyInto(out *Rookout) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Rookout.
@@ -128,6 +161,21 @@ func (in *RookoutList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutPolicy) DeepCopyInto(out *RolloutPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutPolicy.
+func (in *RolloutPolicy) DeepCopy() *RolloutPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RookoutSpec) DeepCopyInto(out *RookoutSpec) {
 	*out = *in
@@ -139,6 +187,11 @@ func (in *RookoutSpec) DeepCopyInto(out *RookoutSpec) {
 		}
 	}
 	out.InitContainer = in.InitContainer
+	if in.RolloutPolicy != nil {
+		in, out := &in.RolloutPolicy, &out.RolloutPolicy
+		*out = new(RolloutPolicy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RookoutSpec.
@@ -154,6 +207,43 @@ func (in *RookoutSpec) DeepCopy() *RookoutSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RookoutStatus) DeepCopyInto(out *RookoutStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MatchedWorkloads != nil {
+		in, out := &in.MatchedWorkloads, &out.MatchedWorkloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PatchedWorkloads != nil {
+		in, out := &in.PatchedWorkloads, &out.PatchedWorkloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailedWorkloads != nil {
+		in, out := &in.FailedWorkloads, &out.FailedWorkloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.DryRunWorkloads != nil {
+		in, out := &in.DryRunWorkloads, &out.DryRunWorkloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingWorkloads != nil {
+		in, out := &in.PendingWorkloads, &out.PendingWorkloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.QuarantinedWorkloads != nil {
+		in, out := &in.QuarantinedWorkloads, &out.QuarantinedWorkloads
+		*out = make([]WorkloadStatus, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RookoutStatus.
@@ -165,3 +255,33 @@ func (in *RookoutStatus) DeepCopy() *RookoutStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TokenSecretRef) DeepCopyInto(out *TokenSecretRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TokenSecretRef.
+func (in *TokenSecretRef) DeepCopy() *TokenSecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(TokenSecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkloadStatus) DeepCopyInto(out *WorkloadStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkloadStatus.
+func (in *WorkloadStatus) DeepCopy() *WorkloadStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkloadStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Set on the pod template of instrumented workloads, holds the namespace/name of the configuration which injected the agent
+	ConfigurationAnnotation = "rookout.com/configuration"
+	// Set on the pod template of instrumented workloads, holds the matcher which won for every instrumented container
+	InjectedMatchersAnnotation = "rookout.com/matchers"
+)
+
+type OperatorConfiguration struct {
+	rookoutv1alpha1.Rookout
+	isReady bool
+	// Reported in the Ready condition of the configuration's status
+	readyReason  string
+	readyMessage string
+	// The configuration's matchers, compiled and sorted by priority
+	matchers []*compiledMatcher
+	// Hash of the tokens read from the token secrets of the configuration, empty if it doesn't use token secrets
+	tokenHash string
+	// Hash of the spec (with defaults applied), recorded in the patch state of the workloads using the configuration
+	configHash string
+}
+
+// ConfigurationsManager holds every Rookout resource in the cluster (with defaults applied).
+// A workload is instrumented by a single configuration: the first ready configuration (oldest first) having a matcher
+// for one of its containers, only this configuration's matchers and init container settings are used for the workload
+type ConfigurationsManager struct {
+	lock           sync.RWMutex
+	configurations map[types.NamespacedName]*OperatorConfiguration
+	// Init container settings of the deleted configurations waiting for the agent to be removed from their workloads
+	// (see finalizeConfiguration)
+	finalizing map[string]rookoutv1alpha1.InitContainer
+}
+
+// Shared by the reconciler and the admission webhooks
+var configurations = NewConfigurationsManager()
+
+func NewConfigurationsManager() *ConfigurationsManager {
+	return &ConfigurationsManager{
+		configurations: make(map[types.NamespacedName]*OperatorConfiguration),
+		finalizing:     make(map[string]rookoutv1alpha1.InitContainer),
+	}
+}
+
+func (c *ConfigurationsManager) Update(configuration *OperatorConfiguration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.configurations[types.NamespacedName{Namespace: configuration.Namespace, Name: configuration.Name}] = configuration
+}
+
+func (c *ConfigurationsManager) Remove(namespacedName types.NamespacedName) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.configurations, namespacedName)
+	delete(c.finalizing, namespacedName.String())
+}
+
+// Keeps the init container settings of the deleted configuration until the agent is removed from its workloads,
+// nil once it is
+func (c *ConfigurationsManager) SetFinalizing(namespacedName types.NamespacedName, initContainer *rookoutv1alpha1.InitContainer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if initContainer != nil {
+		c.finalizing[namespacedName.String()] = *initContainer
+	} else {
+		delete(c.finalizing, namespacedName.String())
+	}
+}
+
+// key is the namespace/name of the configuration
+func (c *ConfigurationsManager) IsFinalizing(key string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	_, ok := c.finalizing[key]
+	return ok
+}
+
+// All configurations, by precedence
+func (c *ConfigurationsManager) List() []*OperatorConfiguration {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	list := make([]*OperatorConfiguration, 0, len(c.configurations))
+	for _, configuration := range c.configurations {
+		list = append(list, configuration)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreationTimestamp.Equal(&list[j].CreationTimestamp) {
+			return list[i].CreationTimestamp.Before(&list[j].CreationTimestamp)
+		}
+		return list[i].key() < list[j].key()
+	})
+
+	return list
+}
+
+func (c *ConfigurationsManager) IsAnyReady() bool {
+	for _, configuration := range c.List() {
+		if configuration.isReady {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *ConfigurationsManager) UsesNamespaceSelector() bool {
+	for _, configuration := range c.List() {
+		if configuration.isReady && configuration.usesNamespaceSelector() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The init container settings of every configuration (deleted ones included until they are finalized), used to remove
+// the agent whichever configuration injected it
+func (c *ConfigurationsManager) InitContainers() []rookoutv1alpha1.InitContainer {
+	initContainers := []rookoutv1alpha1.InitContainer{newOperatorConfiguration(rookoutv1alpha1.Rookout{}).Spec.InitContainer}
+
+	for _, configuration := range c.List() {
+		initContainers = append(initContainers, configuration.Spec.InitContainer)
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, initContainer := range c.finalizing {
+		initContainers = append(initContainers, initContainer)
+	}
+
+	return initContainers
+}
+
+// Namespace scoped configurations only apply to workloads in their own namespace
+func (c *OperatorConfiguration) appliesToNamespace(namespace string) bool {
+	return c.Spec.Scope != rookoutv1alpha1.NamespaceScope || c.Namespace == namespace
+}
+
+func (c *OperatorConfiguration) usesNamespaceSelector() bool {
+	for _, matcher := range c.Spec.Matchers {
+		if matcher.NamespaceSelector != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *OperatorConfiguration) key() string {
+	return types.NamespacedName{Namespace: c.Namespace, Name: c.Name}.String()
+}
+
+func newOperatorConfiguration(config rookoutv1alpha1.Rookout) *OperatorConfiguration {
+	configuration := &OperatorConfiguration{isReady: false}
+	configuration.ObjectMeta = *config.ObjectMeta.DeepCopy()
+	configuration.Spec.Matchers = config.Spec.Matchers
+	configuration.Spec.InitContainer.Image = getConfigStr(config.Spec.InitContainer.Image, DefaultInitContainerImage)
+	configuration.Spec.InitContainer.ImagePullPolicy = core.PullPolicy(getConfigStr(string(config.Spec.InitContainer.ImagePullPolicy), string(DefaultInitContainerImagePullPolicy)))
+	configuration.Spec.InitContainer.ContainerName = getConfigStr(config.Spec.InitContainer.ContainerName, DefaultInitContainerName)
+	configuration.Spec.InitContainer.SharedVolumeMountPath = getConfigStr(config.Spec.InitContainer.SharedVolumeMountPath, DefaultSharedVolumeMountPath)
+	configuration.Spec.InitContainer.SharedVolumeName = getConfigStr(config.Spec.InitContainer.SharedVolumeName, DefaultSharedVolumeName)
+	configuration.Spec.InjectionMode = rookoutv1alpha1.InjectionMode(getConfigStr(string(config.Spec.InjectionMode), string(rookoutv1alpha1.WorkloadInjectionMode)))
+	configuration.Spec.Scope = rookoutv1alpha1.ConfigurationScope(getConfigStr(string(config.Spec.Scope), string(rookoutv1alpha1.NamespaceScope)))
+	configuration.Spec.AnnotationPolicy = rookoutv1alpha1.AnnotationPolicy(getConfigStr(string(config.Spec.AnnotationPolicy), string(rookoutv1alpha1.OptOutAnnotationPolicy)))
+	configuration.Spec.Mode = rookoutv1alpha1.OperatorMode(getConfigStr(string(config.Spec.Mode), string(rookoutv1alpha1.ApplyOperatorMode)))
+	configuration.Spec.RolloutPolicy = config.Spec.RolloutPolicy
+
+	if config.Spec.RequeueAfter > 0 {
+		configuration.Spec.RequeueAfter = config.Spec.RequeueAfter
+	} else {
+		configuration.Spec.RequeueAfter = DefaultRequeueAfter
+	}
+	configuration.configHash = hashConfigurationSpec(configuration.Spec)
+
+	if len(configuration.Spec.Matchers) == 0 {
+		logrus.Errorf("No matchers found in configuration %s", configuration.key())
+		configuration.readyReason = "NoMatchers"
+		configuration.readyMessage = "No matchers found in configuration"
+		return configuration
+	}
+
+	for i, matcher := range configuration.Spec.Matchers {
+		compiled, err := compileMatcher(matcher)
+		if err != nil {
+			logrus.Errorf("Matcher #%d of configuration %s is invalid: %v", i, configuration.key(), err)
+			configuration.readyReason = "InvalidMatcher"
+			configuration.readyMessage = fmt.Sprintf("Matcher #%d: %v", i, err)
+			configuration.matchers = nil
+			return configuration
+		}
+
+		compiled.id = getConfigStr(matcher.Name, fmt.Sprintf("#%d", i))
+		configuration.matchers = append(configuration.matchers, compiled)
+	}
+
+	// Evaluation order, higher priority first
+	sort.SliceStable(configuration.matchers, func(i, j int) bool {
+		return configuration.matchers[i].Priority > configuration.matchers[j].Priority
+	})
+
+	for i, matcher := range configuration.Spec.Matchers {
+		if !matcher.Exclude && !matcher.HasRookoutConnection() {
+			logrus.Infof("Are you trying to connect to a deployed Rookout controller? if so, use %s and if you don't, use %s. See our docs at docs.rookout.com\"t", RookoutControllerHostEnvVar, RookoutTokenEnvVar)
+			configuration.readyReason = "MissingRookoutConnection"
+			configuration.readyMessage = fmt.Sprintf("Matcher #%d has neither %s nor %s env var", i, RookoutTokenEnvVar, RookoutControllerHostEnvVar)
+			return configuration
+		}
+	}
+
+	configuration.isReady = true
+	configuration.readyReason = "ConfigurationValid"
+	configuration.readyMessage = "Operator configuration updated"
+	logrus.Infof("Operator configuration %s updated", configuration.key())
+	return configuration
+}
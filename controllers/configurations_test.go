@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func newTestConfiguration(namespace string, name string, created time.Time, matcher rookout.Matcher) rookout.Rookout {
+	matcher.EnvVars = []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: name}}
+
+	config := rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{matcher}}}
+	config.Namespace = namespace
+	config.Name = name
+	config.CreationTimestamp = metav1.NewTime(created)
+	return config
+}
+
+// Replaces the configurations the workloads are matched against until the test ends
+func useTestConfigurations(t *testing.T) {
+	previousConfigurations := configurations
+	configurations = NewConfigurationsManager()
+	t.Cleanup(func() { configurations = previousConfigurations })
+}
+
+// A reconciler whose client is a fake one holding the objects
+func newTestReconciler(t *testing.T, objects ...client.Object) *RookoutReconciler {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, rookout.AddToScheme(scheme))
+
+	return &RookoutReconciler{
+		Client:             fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		DeploymentsManager: NewDeploymentsManager(),
+		rollouts:           newRolloutTracker(),
+	}
+}
+
+func newTestDeployment(namespace string, name string) *apps.Deployment {
+	deployment := &apps.Deployment{}
+	deployment.Namespace = namespace
+	deployment.Name = name
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+	return deployment
+}
+
+// Reads the deployment from the reconciler's client, as the workload controller would
+func getTestWorkload(t *testing.T, reconciler *RookoutReconciler, namespace string, name string) *Workload {
+	deployment := &apps.Deployment{}
+	require.NoError(t, reconciler.Client.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, deployment))
+	workload, err := newWorkload(deployment)
+	require.NoError(t, err)
+	return workload
+}
+
+func TestConfigurationsPrecedence(t *testing.T) {
+	assert := require.New(t)
+
+	previousConfigurations := configurations
+	configurations = NewConfigurationsManager()
+	defer func() { configurations = previousConfigurations }()
+
+	now := time.Now()
+	for _, config := range []rookout.Rookout{
+		newTestConfiguration("team-b", "rookout", now, rookout.Matcher{}),
+		newTestConfiguration("team-a", "rookout", now.Add(-time.Hour), rookout.Matcher{Namespace: "team-a"}),
+		newTestConfiguration("team-c", "rookout", now, rookout.Matcher{}),
+	} {
+		config.Spec.Scope = rookout.ClusterScope
+		configurations.Update(newOperatorConfiguration(config))
+	}
+	// Not ready, since it has no matchers
+	configurations.Update(newOperatorConfiguration(rookout.Rookout{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broken", CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour))}}))
+
+	var keys []string
+	for _, configuration := range configurations.List() {
+		keys = append(keys, configuration.key())
+	}
+	assert.Equal([]string{"default/broken", "team-a/rookout", "team-b/rookout", "team-c/rookout"}, keys)
+	assert.True(configurations.IsAnyReady())
+
+	deployment := &apps.Deployment{}
+	deployment.Namespace = "team-a"
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+
+	// Oldest ready configuration matching the workload wins
+	assert.Equal("team-a/rookout", findWorkloadConfiguration(workload).key())
+
+	deployment.Namespace = "team-c"
+	assert.Equal("team-b/rookout", findWorkloadConfiguration(workload).key())
+
+	configurations.Remove(types.NamespacedName{Namespace: "team-b", Name: "rookout"})
+	assert.Equal("team-c/rookout", findWorkloadConfiguration(workload).key())
+
+	injectAgent(findWorkloadConfiguration(workload), workload)
+	assert.Equal("team-c/rookout", deployment.Spec.Template.Annotations[ConfigurationAnnotation])
+	assert.Equal([]v1.EnvVar{
+		{Name: RookoutTokenEnvVar, Value: "rookout"},
+		{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/rookout/rook.jar"},
+	}, deployment.Spec.Template.Spec.Containers[0].Env)
+
+	configurations.Remove(types.NamespacedName{Namespace: "team-c", Name: "rookout"})
+	assert.Nil(findWorkloadConfiguration(workload))
+}
+
+func TestNamespaceScope(t *testing.T) {
+	assert := require.New(t)
+
+	config := newTestConfiguration("team-a", "rookout", time.Now(), rookout.Matcher{})
+	namespaceConfiguration := newOperatorConfiguration(config)
+	config.Spec.Scope = rookout.ClusterScope
+	clusterConfiguration := newOperatorConfiguration(config)
+
+	deployment := &apps.Deployment{}
+	deployment.Namespace = "team-a"
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+
+	assert.Equal(rookout.NamespaceScope, namespaceConfiguration.Spec.Scope)
+	assert.True(isWorkloadMatched(clusterConfiguration, workload))
+	assert.True(isWorkloadMatched(namespaceConfiguration, workload))
+
+	deployment.Namespace = "team-b"
+	assert.True(isWorkloadMatched(clusterConfiguration, workload))
+	assert.False(isWorkloadMatched(namespaceConfiguration, workload))
+}
+
+func TestClusterScopeNamespaces(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	tenant := newTestConfiguration("team-a", "rookout", time.Now(), rookout.Matcher{})
+	tenant.Spec.Scope = rookout.ClusterScope
+	admin := newTestConfiguration("rookout", "rookout", time.Now(), rookout.Matcher{})
+	admin.Spec.Scope = rookout.ClusterScope
+
+	reconciler := newTestReconciler(t, &tenant, &admin)
+	reconciler.ClusterScopeNamespaces = []string{"rookout"}
+	reconciler.workloadEvents = map[rookout.WorkloadKind]chan event.GenericEvent{}
+	for _, kind := range supportedWorkloadKinds {
+		reconciler.workloadEvents[kind] = make(chan event.GenericEvent, 10)
+	}
+
+	for _, config := range []rookout.Rookout{tenant, admin} {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: config.Namespace, Name: config.Name}})
+		assert.NoError(err)
+	}
+
+	// A tenant can't instrument other namespaces by creating a configuration in its own
+	status := &rookout.Rookout{}
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: "rookout"}, status))
+	assert.Equal("ClusterScopeNotAllowed", meta.FindStatusCondition(status.Status.Conditions, rookout.ReadyCondition).Reason)
+
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "rookout", Name: "rookout"}, status))
+	assert.True(meta.IsStatusConditionTrue(status.Status.Conditions, rookout.ReadyCondition))
+}
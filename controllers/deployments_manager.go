@@ -1,54 +1,109 @@
 package controllers
 
 import (
-	apps "k8s.io/api/apps/v1"
+	"errors"
+	"sync"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
-// We are saving a state of all running deployments in the cluster
+// Workloads themselves are read from the manager's cache (patched ones are indexed by configuration), we only keep the
+// outcome of the last sync of each workload, shared by concurrent reconciles
 type DeploymentsManager struct {
-	Deployments map[string]*RunningDeployment
+	lock sync.RWMutex
+	// Reported in the status of the configuration matching the workload
+	syncResults map[string]*WorkloadSyncResult
 }
 
-type RunningDeployment struct {
-	*apps.Deployment
-	isPatched bool
+type WorkloadSyncResult struct {
+	rookoutv1alpha1.WorkloadStatus
+	// namespace/name of the configuration matching the workload, empty if no configuration matches it
+	configuration string
+	isMatched     bool
+	isPatched     bool
+	isFailed      bool
+	// Waiting for the configuration's rollout policy, the reason is in the message
+	isPending bool
+	// Unpatched because it became unhealthy, the reason is in the message
+	isQuarantined bool
+	// The patch which would have been sent, in dry run mode
+	dryRunPatch string
 }
 
-func NewDeploymentsManager() DeploymentsManager {
-	return DeploymentsManager{Deployments: make(map[string]*RunningDeployment, 0)}
+func NewDeploymentsManager() *DeploymentsManager {
+	return &DeploymentsManager{
+		syncResults: make(map[string]*WorkloadSyncResult, 0),
+	}
 }
 
-func createDeploymentKey(deployment apps.Deployment) string {
-	return types.NamespacedName{
-		Namespace: deployment.Namespace,
-		Name:      deployment.Name,
-	}.String()
+func createDeploymentKey(kind string, namespacedName types.NamespacedName) string {
+	return kind + "/" + namespacedName.String()
 }
 
-func (d *DeploymentsManager) MarkDeploymentAsPatched(deployment apps.Deployment) {
-	d.Deployments[createDeploymentKey(deployment)] = &RunningDeployment{
-		Deployment: deployment.DeepCopy(),
-		isPatched:  false,
-	}
+func (d *DeploymentsManager) ForgetDeployment(kind string, namespacedName types.NamespacedName) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.syncResults, createDeploymentKey(kind, namespacedName))
 }
 
-func (d *DeploymentsManager) MarkDeploymentAsNotPatched(deployment apps.Deployment) {
-	d.Deployments[createDeploymentKey(deployment)] = &RunningDeployment{
-		Deployment: deployment.DeepCopy(),
-		isPatched:  true,
+func (d *DeploymentsManager) SetSyncResult(workload *Workload, configuration *OperatorConfiguration, patched bool, dryRunPatch string, err error) {
+	result := &WorkloadSyncResult{
+		WorkloadStatus: rookoutv1alpha1.WorkloadStatus{
+			Kind:      workload.Kind,
+			Namespace: workload.GetNamespace(),
+			Name:      workload.GetName(),
+		},
+		isMatched:   configuration != nil,
+		isPatched:   patched,
+		isFailed:    err != nil,
+		dryRunPatch: dryRunPatch,
+	}
+
+	var pending *rolloutPendingError
+	if errors.As(err, &pending) {
+		result.isFailed = false
+		result.isPending = true
+	}
+
+	if configuration != nil {
+		result.configuration = configuration.key()
+		result.Matchers = describeWorkloadMatchers(configuration, workload)
 	}
-}
 
-func (d *DeploymentsManager) ForgetDeployment(namespacedName types.NamespacedName) {
-	key := namespacedName.String()
-	if _, ok := d.Deployments[key]; ok {
-		delete(d.Deployments, key)
+	if err != nil {
+		result.Message = err.Error()
 	}
+
+	if reason, ok := getQuarantineReason(workload); ok && configuration != nil && err == nil {
+		result.isQuarantined = true
+		result.Message = reason
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.syncResults[createDeploymentKey(string(workload.Kind), workload.NamespacedName())] = result
 }
 
-func (d *DeploymentsManager) IsDeploymentMarkedAsPatched(deployment apps.Deployment) bool {
-	mappedDeployment, exist := d.Deployments[createDeploymentKey(deployment)]
+// The last sync result of the workload, nil if it wasn't synced yet
+func (d *DeploymentsManager) GetSyncResult(kind string, namespacedName types.NamespacedName) *WorkloadSyncResult {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.syncResults[createDeploymentKey(kind, namespacedName)]
+}
+
+// A copy, results are never modified once set
+func (d *DeploymentsManager) ListSyncResults() map[string]*WorkloadSyncResult {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	results := make(map[string]*WorkloadSyncResult, len(d.syncResults))
+	for key, result := range d.syncResults {
+		results[key] = result
+	}
 
-	return exist && mappedDeployment.isPatched
+	return results
 }
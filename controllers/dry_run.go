@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"gomodules.xyz/jsonpatch/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func (c *OperatorConfiguration) isDryRun() bool {
+	return c.Spec.Mode == rookoutv1alpha1.DryRunOperatorMode
+}
+
+// With --dry-run nothing is ever patched, not even the workloads no configuration matches anymore
+func (r *RookoutReconciler) isDryRun(configuration *OperatorConfiguration) bool {
+	return r.DryRun || (configuration != nil && configuration.isDryRun())
+}
+
+// Patches the workload with the changes made to it since the original was copied. In dry run mode (of the operator or
+// of the configuration matching the workload) these changes are reverted and returned as a JSON patch instead
+func (r *RookoutReconciler) sendPatch(ctx context.Context, workload *Workload, originalWorkload client.Object, configuration *OperatorConfiguration) (string, error) {
+	if !r.isDryRun(configuration) {
+		return "", r.Client.Patch(ctx, workload.Object, client.MergeFrom(originalWorkload))
+	}
+
+	patch, err := createJSONPatch(originalWorkload, workload.Object)
+	if err != nil {
+		return "", err
+	}
+
+	restoreWorkload(workload, originalWorkload)
+	logrus.Infof("Dry run, not patching %s: %s", workload, patch)
+	return patch, nil
+}
+
+// Reverts the changes made to the workload since the original was copied. The object is overwritten in place, so the
+// caller's object and the workload's pod template keep pointing at it
+func restoreWorkload(workload *Workload, originalWorkload client.Object) {
+	reflect.ValueOf(workload.Object).Elem().Set(reflect.ValueOf(originalWorkload.DeepCopyObject()).Elem())
+}
+
+// Empty when the objects are equal
+func createJSONPatch(original client.Object, modified client.Object) (string, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return "", err
+	}
+
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return "", err
+	}
+
+	operations, err := jsonpatch.CreatePatch(originalJSON, modifiedJSON)
+	if err != nil || len(operations) == 0 {
+		return "", err
+	}
+
+	patch, err := json.Marshal(operations)
+	if err != nil {
+		return "", err
+	}
+
+	return string(patch), nil
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"gomodules.xyz/jsonpatch/v2"
+)
+
+func TestDryRun(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Spec.Mode = rookout.DryRunOperatorMode
+	configuration := newOperatorConfiguration(config)
+	configurations.Update(configuration)
+
+	deployment := newTestDeployment("default", "api")
+	original := deployment.DeepCopy()
+	reconciler := newTestReconciler(t, deployment)
+
+	workload := getTestWorkload(t, reconciler, "default", "api")
+	assert.NoError(reconciler.syncWorkload(ctx, workload))
+	assert.False(isWorkloadPatched(workload))
+
+	current := getTestWorkload(t, reconciler, "default", "api")
+	assert.Equal(original.Spec.Template, *current.PodTemplate)
+	assert.NotContains(current.GetAnnotations(), PatchStateAnnotation)
+
+	status := buildStatus(configuration, rookout.RookoutStatus{}, reconciler.DeploymentsManager.ListSyncResults())
+	assert.Equal(0, status.PatchedCount)
+	assert.Equal(1, status.DryRunCount)
+	assert.Len(status.DryRunWorkloads, 1)
+
+	var operations []jsonpatch.Operation
+	assert.NoError(json.Unmarshal([]byte(status.DryRunWorkloads[0].Patch), &operations))
+	paths := map[string]bool{}
+	for _, operation := range operations {
+		paths[operation.Path] = true
+	}
+	assert.True(paths["/spec/template/spec/initContainers"])
+	assert.True(paths["/metadata/annotations"])
+
+	// Nothing to report once the workload is in the desired state
+	patch, err := createJSONPatch(original, original.DeepCopy())
+	assert.NoError(err)
+	assert.Empty(patch)
+}
+
+func TestDryRunOperator(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	// Patched before the operator was restarted with --dry-run, no configuration matches it anymore
+	configuration := newOperatorConfiguration(newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{}))
+	deployment := newTestDeployment("default", "api")
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+	injectAgent(configuration, workload)
+	patched := deployment.DeepCopy()
+
+	reconciler := newTestReconciler(t, deployment)
+	reconciler.DryRun = true
+
+	assert.NoError(reconciler.syncWorkload(ctx, getTestWorkload(t, reconciler, "default", "api")))
+	current := getTestWorkload(t, reconciler, "default", "api")
+	assert.Equal(patched.Spec.Template, *current.PodTemplate)
+	assert.Equal(patched.Annotations, current.GetAnnotations())
+
+	assert.NoError(reconciler.quarantineWorkload(ctx, current, "rollout failed"))
+	current = getTestWorkload(t, reconciler, "default", "api")
+	assert.Equal(patched.Spec.Template, *current.PodTemplate)
+	_, ok := getQuarantineReason(current)
+	assert.False(ok)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"errors"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Reasons of the events recorded on workloads and configurations, so `kubectl describe` explains what the operator did
+const (
+	AgentInjectedEventReason        = "AgentInjected"
+	AgentUpdatedEventReason         = "AgentUpdated"
+	AgentRemovedEventReason         = "AgentRemoved"
+	PatchFailedEventReason          = "PatchFailed"
+	UnpatchFailedEventReason        = "UnpatchFailed"
+	QuarantinedEventReason          = "Quarantined"
+	InvalidConfigurationEventReason = "InvalidConfiguration"
+	WorkloadsSyncedEventReason      = "WorkloadsSynced"
+)
+
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Nothing is recorded when the reconciler has no recorder (tests)
+func (r *RookoutReconciler) recordEvent(object runtime.Object, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+
+	r.Recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// Records on the configuration why it became invalid and how many workloads it synced, when those changed
+func (r *RookoutReconciler) recordStatusEvents(config *rookoutv1alpha1.Rookout, previousStatus rookoutv1alpha1.RookoutStatus) {
+	previousReady := meta.FindStatusCondition(previousStatus.Conditions, rookoutv1alpha1.ReadyCondition)
+	ready := meta.FindStatusCondition(config.Status.Conditions, rookoutv1alpha1.ReadyCondition)
+	if ready != nil && !meta.IsStatusConditionTrue(config.Status.Conditions, rookoutv1alpha1.ReadyCondition) &&
+		(previousReady == nil || previousReady.Status != ready.Status || previousReady.Reason != ready.Reason || previousReady.Message != ready.Message) {
+		r.recordEvent(config, core.EventTypeWarning, InvalidConfigurationEventReason, "Configuration invalid, %s: %s", ready.Reason, ready.Message)
+	}
+
+	status := config.Status
+	if status.MatchedCount == previousStatus.MatchedCount && status.PatchedCount == previousStatus.PatchedCount &&
+		status.FailedCount == previousStatus.FailedCount && status.QuarantinedCount == previousStatus.QuarantinedCount {
+		return
+	}
+
+	eventType := core.EventTypeNormal
+	if status.FailedCount > 0 || status.QuarantinedCount > 0 {
+		eventType = core.EventTypeWarning
+	}
+	r.recordEvent(config, eventType, WorkloadsSyncedEventReason, "%d workloads synced: %d patched, %d failed, %d quarantined",
+		status.MatchedCount, status.PatchedCount, status.FailedCount, status.QuarantinedCount)
+}
+
+// Rollouts waiting for their turn aren't failures, they are reported in the configuration's status
+func (r *RookoutReconciler) recordPatchFailure(workload *Workload, reason string, err error) {
+	var pending *rolloutPendingError
+	if errors.As(err, &pending) {
+		return
+	}
+
+	message := "patch failed: %v"
+	if reason == UnpatchFailedEventReason {
+		message = "unpatch failed: %v"
+	}
+	r.recordEvent(workload.Object, core.EventTypeWarning, reason, message, err)
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEvents(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{Name: "java"})
+	configuration := newOperatorConfiguration(config)
+	configurations.Update(configuration)
+
+	recorder := record.NewFakeRecorder(10)
+	reconciler := newTestReconciler(t, &config, newTestDeployment("default", "api"))
+	reconciler.Recorder = recorder
+	getWorkload := func() *Workload {
+		return getTestWorkload(t, reconciler, "default", "api")
+	}
+
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.Equal("Normal AgentInjected Rookout agent injected by configuration default/rookout, matchers app=java", <-recorder.Events)
+
+	assert.NoError(reconciler.updateStatus(ctx))
+	assert.Equal("Normal WorkloadsSynced 1 workloads synced: 1 patched, 0 failed, 0 quarantined", <-recorder.Events)
+
+	// Nothing changed
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.NoError(reconciler.updateStatus(ctx))
+	assert.Empty(recorder.Events)
+
+	config.Spec.Matchers = nil
+	configuration = newOperatorConfiguration(config)
+	configurations.Update(configuration)
+
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.Equal("Normal AgentRemoved Rookout agent removed", <-recorder.Events)
+
+	assert.NoError(reconciler.updateStatus(ctx))
+	assert.Contains(<-recorder.Events, "Warning InvalidConfiguration Configuration invalid, NoMatchers: ")
+	assert.Equal("Normal WorkloadsSynced 0 workloads synced: 0 patched, 0 failed, 0 quarantined", <-recorder.Events)
+	assert.Empty(recorder.Events)
+}
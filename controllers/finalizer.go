@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// Keeps a deleted configuration until the agent is removed from every workload it patched
+	CleanupFinalizer = "rookout.com/cleanup"
+	// Set to "true" on a deleted configuration to release it without waiting for the cleanup (e.g. when the operator
+	// is uninstalled before its configurations)
+	ForceRemovalAnnotation = "rookout.com/force-removal"
+)
+
+func isForceRemoval(config *rookoutv1alpha1.Rookout) bool {
+	return strings.EqualFold(strings.TrimSpace(config.Annotations[ForceRemovalAnnotation]), "true")
+}
+
+// Status updates don't change the configuration's generation, the force removal annotation neither
+var forceRemovalAnnotationChangedPredicate = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return false
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return e.ObjectOld.GetAnnotations()[ForceRemovalAnnotation] != e.ObjectNew.GetAnnotations()[ForceRemovalAnnotation]
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+func (r *RookoutReconciler) addCleanupFinalizer(ctx context.Context, config *rookoutv1alpha1.Rookout) error {
+	if controllerutil.ContainsFinalizer(config, CleanupFinalizer) {
+		return nil
+	}
+
+	patch := client.MergeFrom(config.DeepCopy())
+	controllerutil.AddFinalizer(config, CleanupFinalizer)
+	return r.Client.Patch(ctx, config, patch)
+}
+
+// Enqueues every workload the deleted configuration patched, so their controller removes the agent (or patches the
+// workload with another configuration matching it), until none is left. The configuration is released then, or right
+// away when its removal is forced
+func (r *RookoutReconciler) finalizeConfiguration(ctx context.Context, config *rookoutv1alpha1.Rookout) (ctrl.Result, error) {
+	key := types.NamespacedName{Namespace: config.Namespace, Name: config.Name}
+	configurations.Remove(key)
+
+	if !controllerutil.ContainsFinalizer(config, CleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	workloads, err := r.listConfigurationWorkloads(ctx, key)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(workloads) > 0 && !isForceRemoval(config) {
+		// Workloads patched by a version which didn't record the injected init container in their patch state
+		configurations.SetFinalizing(key, &newOperatorConfiguration(*config).Spec.InitContainer)
+
+		var failed []string
+		for _, workload := range workloads {
+			// Synced since the configuration was deleted, waiting for a rollout policy isn't a failure
+			result := r.DeploymentsManager.GetSyncResult(string(workload.Kind), workload.NamespacedName())
+			if result != nil && result.isFailed && result.configuration != key.String() {
+				failed = append(failed, fmt.Sprintf("%s (%s)", workload, result.Message))
+			}
+
+			r.workloadEvents[workload.Kind] <- event.GenericEvent{Object: workload.Object}
+		}
+
+		reason, message := "InProgress", fmt.Sprintf("Removing the agent from %d workloads", len(workloads))
+		if len(failed) > 0 {
+			reason = "Failed"
+			message = fmt.Sprintf("Failed to remove the agent from %d of %d workloads: %s", len(failed), len(workloads), strings.Join(failed, ", "))
+			logrus.Errorf("Configuration %s: %s", key, message)
+		} else {
+			logrus.Infof("Removing rookout agent from %d workloads patched by deleted configuration %s", len(workloads), key)
+		}
+
+		err = r.updateCleanupStatus(ctx, config, len(workloads), reason, message)
+		return ctrl.Result{RequeueAfter: DefaultRequeueAfter}, err
+	}
+
+	if len(workloads) > 0 {
+		logrus.Warnf("Forcing removal of configuration %s, the agent wasn't removed from %d workloads", key, len(workloads))
+	}
+
+	logrus.Infof("Configuration %s cleaned up", key)
+	configurations.SetFinalizing(key, nil)
+	patch := client.MergeFrom(config.DeepCopy())
+	controllerutil.RemoveFinalizer(config, CleanupFinalizer)
+	return ctrl.Result{}, r.Client.Patch(ctx, config, patch)
+}
+
+func (r *RookoutReconciler) updateCleanupStatus(ctx context.Context, config *rookoutv1alpha1.Rookout, pending int, reason string, message string) error {
+	config.Status.CleanupPendingCount = pending
+	meta.SetStatusCondition(&config.Status.Conditions, metav1.Condition{
+		Type:               rookoutv1alpha1.CleanupCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: config.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+
+	return r.Client.Status().Update(ctx, config)
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestFinalizeConfiguration(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Finalizers = []string{CleanupFinalizer}
+	configuration := newOperatorConfiguration(config)
+
+	deployment := newTestDeployment("default", "api")
+	original := deployment.DeepCopy()
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+	injectAgent(configuration, workload)
+
+	now := metav1.Now()
+	config.DeletionTimestamp = &now
+	configurations.Update(configuration)
+
+	reconciler := newTestReconciler(t, &config, deployment)
+	events := make(chan event.GenericEvent, 10)
+	reconciler.workloadEvents = map[rookout.WorkloadKind]chan event.GenericEvent{rookout.DeploymentKind: events}
+	key := types.NamespacedName{Namespace: "default", Name: "rookout"}
+	released := &rookout.Rookout{}
+
+	// The workload is unpatched by its own controller
+	result, err := reconciler.finalizeConfiguration(ctx, &config)
+	assert.NoError(err)
+	assert.NotZero(result.RequeueAfter)
+	assert.Empty(configurations.List())
+	assert.Equal("api", (<-events).Object.GetName())
+	assert.NoError(reconciler.Client.Get(ctx, key, released))
+	assert.Equal([]string{CleanupFinalizer}, released.Finalizers)
+	assert.Equal("InProgress", released.Status.Conditions[0].Reason)
+	assert.Equal(1, released.Status.CleanupPendingCount)
+
+	workloadReconciler := &workloadReconciler{RookoutReconciler: reconciler, kind: rookout.DeploymentKind}
+	_, err = workloadReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "api"}})
+	assert.NoError(err)
+
+	unpatched := getTestWorkload(t, reconciler, "default", "api")
+	assert.Equal(original.Spec.Template.Spec, unpatched.PodTemplate.Spec)
+	assert.NotContains(unpatched.GetAnnotations(), PatchStateAnnotation)
+
+	assert.NoError(reconciler.Client.Get(ctx, key, released))
+	result, err = reconciler.finalizeConfiguration(ctx, released)
+	assert.NoError(err)
+	assert.Zero(result.RequeueAfter)
+	assert.Empty(events)
+	assert.False(configurations.IsFinalizing(key.String()))
+
+	assert.NoError(reconciler.Client.Get(ctx, key, released))
+	assert.Empty(released.Finalizers)
+}
+
+func TestFinalizeConfigurationPendingRollout(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Finalizers = []string{CleanupFinalizer}
+	configuration := newOperatorConfiguration(config)
+
+	deployment := newTestDeployment("default", "api")
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+	injectAgent(configuration, workload)
+
+	now := metav1.Now()
+	config.DeletionTimestamp = &now
+	reconciler := newTestReconciler(t, &config, deployment)
+	reconciler.workloadEvents = map[rookout.WorkloadKind]chan event.GenericEvent{rookout.DeploymentKind: make(chan event.GenericEvent, 10)}
+
+	// Unpatching waits for the rollout policy of another configuration
+	reconciler.DeploymentsManager.SetSyncResult(workload, nil, true, "", &rolloutPendingError{reason: "2 workloads are rolling out"})
+
+	result, err := reconciler.finalizeConfiguration(ctx, &config)
+	assert.NoError(err)
+	assert.NotZero(result.RequeueAfter)
+
+	released := &rookout.Rookout{}
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "rookout"}, released))
+	assert.Equal([]string{CleanupFinalizer}, released.Finalizers)
+	assert.Equal("InProgress", released.Status.Conditions[0].Reason)
+
+	reconciler.DeploymentsManager.SetSyncResult(workload, nil, true, "", fmt.Errorf("conflict"))
+	_, err = reconciler.finalizeConfiguration(ctx, released)
+	assert.NoError(err)
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "rookout"}, released))
+	assert.Equal("Failed", released.Status.Conditions[0].Reason)
+
+	// Forced removal doesn't wait for the workloads
+	released.Annotations = map[string]string{ForceRemovalAnnotation: "true"}
+	result, err = reconciler.finalizeConfiguration(ctx, released)
+	assert.NoError(err)
+	assert.Zero(result.RequeueAfter)
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "rookout"}, released))
+	assert.Empty(released.Finalizers)
+}
+
+func TestFinalizeConfigurationCustomInitContainer(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Finalizers = []string{CleanupFinalizer}
+	config.Spec.InitContainer = rookout.InitContainer{ContainerName: "custom-init", SharedVolumeName: "custom-vol", SharedVolumeMountPath: "/custom"}
+	configuration := newOperatorConfiguration(config)
+
+	// legacy was patched by a version which didn't record the init container in the patch state
+	var deployments []*apps.Deployment
+	for _, name := range []string{"api", "legacy"} {
+		deployment := newTestDeployment("default", name)
+		workload, err := newWorkload(deployment)
+		assert.NoError(err)
+		injectAgent(configuration, workload)
+		deployments = append(deployments, deployment)
+	}
+	original := newTestDeployment("default", "api")
+	delete(deployments[1].Annotations, PatchStateAnnotation)
+
+	now := metav1.Now()
+	config.DeletionTimestamp = &now
+	reconciler := newTestReconciler(t, &config, deployments[0], deployments[1])
+	events := make(chan event.GenericEvent, 10)
+	reconciler.workloadEvents = map[rookout.WorkloadKind]chan event.GenericEvent{rookout.DeploymentKind: events}
+	workloadReconciler := &workloadReconciler{RookoutReconciler: reconciler, kind: rookout.DeploymentKind}
+
+	result, err := reconciler.finalizeConfiguration(ctx, &config)
+	assert.NoError(err)
+	assert.NotZero(result.RequeueAfter)
+	assert.Len(events, 2)
+
+	for len(events) > 0 {
+		name := (<-events).Object.GetName()
+		_, err = workloadReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+		assert.NoError(err)
+
+		unpatched := getTestWorkload(t, reconciler, "default", name)
+		assert.Equal(original.Spec.Template.Spec, unpatched.PodTemplate.Spec)
+		assert.False(isWorkloadPatched(unpatched))
+	}
+
+	released := &rookout.Rookout{}
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "rookout"}, released))
+	result, err = reconciler.finalizeConfiguration(ctx, released)
+	assert.NoError(err)
+	assert.Zero(result.RequeueAfter)
+	assert.NotContains(configurations.InitContainers(), configuration.Spec.InitContainer)
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+)
+
+// The injection logic is shared by the reconciler (patching workloads) and the admission webhooks (patching objects
+// on creation), it only modifies the workload's pod template in memory
+
+// Returns the first matcher (by priority) matching the container, which might be an exclude matcher
+func findContainerMatcher(configuration *OperatorConfiguration, workload *Workload, container core.Container) *compiledMatcher {
+	if !configuration.appliesToNamespace(workload.GetNamespace()) {
+		return nil
+	}
+
+	for _, matcher := range configuration.matchers {
+		if workloadMatch(matcher, workload) && containerMatch(matcher, container) && imageMatch(matcher, container) {
+			return matcher
+		}
+	}
+
+	return nil
+}
+
+// Containers without a matcher, excluded (by a matcher or the workload's annotations) or without a (detected) runtime
+// are left untouched
+func findContainerInjection(configuration *OperatorConfiguration, workload *Workload, container core.Container) (*compiledMatcher, rookoutv1alpha1.Runtime, string) {
+	matcher, annotationsReason := applyWorkloadAnnotations(configuration, workload, container, findContainerMatcher(configuration, workload, container))
+	if matcher == nil {
+		return nil, "", getConfigStr(annotationsReason, "no matcher found")
+	}
+
+	if matcher.Exclude {
+		return nil, "", fmt.Sprintf("excluded by matcher %s", matcher.id)
+	}
+
+	runtime, reason := resolveContainerRuntime(workload, container, &matcher.Matcher)
+	if annotationsReason != "" {
+		reason = annotationsReason + ", " + reason
+	}
+
+	return matcher, runtime, reason
+}
+
+// The matcher which won for every container the agent would be injected to, "container=matcher" comma separated
+func describeWorkloadMatchers(configuration *OperatorConfiguration, workload *Workload) string {
+	var matchers []string
+
+	for _, container := range workload.PodTemplate.Spec.Containers {
+		if matcher, runtime, _ := findContainerInjection(configuration, workload, container); runtime != "" {
+			matchers = append(matchers, container.Name+"="+matcher.id)
+		}
+	}
+
+	return strings.Join(matchers, ",")
+}
+
+func isWorkloadMatched(configuration *OperatorConfiguration, workload *Workload) bool {
+	for _, container := range workload.PodTemplate.Spec.Containers {
+		if _, runtime, _ := findContainerInjection(configuration, workload, container); runtime != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the configuration instrumenting the workload, which is the first ready configuration (by precedence)
+// matching it, or nil if no configuration matches the workload
+func findWorkloadConfiguration(workload *Workload) *OperatorConfiguration {
+	for _, configuration := range configurations.List() {
+		if configuration.isReady && isWorkloadMatched(configuration, workload) {
+			return configuration
+		}
+	}
+
+	return nil
+}
+
+func injectAgent(configuration *OperatorConfiguration, workload *Workload) {
+	podSpec := &workload.PodTemplate.Spec
+	var injectedRuntimes []string
+	var injectedMatchers []string
+	annotationEnvVars := getAnnotationEnvVars(configuration, workload)
+	state := &patchState{
+		ConfigHash:            configuration.configHash,
+		AgentVersion:          imageTag(configuration.Spec.InitContainer.Image),
+		EnvVars:               map[string][]string{},
+		InitContainerName:     configuration.Spec.InitContainer.ContainerName,
+		SharedVolumeName:      configuration.Spec.InitContainer.SharedVolumeName,
+		SharedVolumeMountPath: configuration.Spec.InitContainer.SharedVolumeMountPath,
+	}
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+
+		logrus.Infof("Validating container %s of %s", container.Name, workload)
+		matcher, runtime, reason := findContainerInjection(configuration, workload, *container)
+		if matcher == nil {
+			logrus.Infof("Skipping container %s of %s, %s", container.Name, workload, reason)
+			continue
+		}
+
+		if runtime == "" {
+			logrus.Infof("Skipping container %s of %s, %s", container.Name, workload, reason)
+			injectedRuntimes = append(injectedRuntimes, container.Name+"="+SkippedRuntime)
+			continue
+		}
+
+		logrus.Infof("Injecting %s agent to container %s of %s (%s, matcher %s)", runtime, container.Name, workload, reason, matcher.id)
+		injectedRuntimes = append(injectedRuntimes, container.Name+"="+string(runtime))
+		injectedMatchers = append(injectedMatchers, container.Name+"="+matcher.id)
+
+		existingEnvVars := append([]core.EnvVar{}, container.Env...)
+		setRookoutEnvVars(&container.Env, matcher.EnvVars)
+		if matcher.TokenSecretRef != nil {
+			container.Env = append(container.Env, tokenSecretEnvVar(matcher.TokenSecretRef))
+		}
+		container.Env = setAnnotationEnvVars(container.Env, annotationEnvVars)
+		container.Env = getRuntimeInjector(runtime).addAgentEnvVars(container.Env, configuration.Spec.InitContainer.SharedVolumeMountPath)
+
+		if names := addedEnvVarNames(existingEnvVars, container.Env); len(names) > 0 {
+			state.EnvVars[container.Name] = names
+		}
+
+		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
+			Name:      configuration.Spec.InitContainer.SharedVolumeName,
+			MountPath: configuration.Spec.InitContainer.SharedVolumeMountPath,
+		})
+	}
+
+	if workload.PodTemplate.Annotations == nil {
+		workload.PodTemplate.Annotations = map[string]string{}
+	}
+	workload.PodTemplate.Annotations[InjectedRuntimesAnnotation] = strings.Join(injectedRuntimes, ",")
+	workload.PodTemplate.Annotations[InjectedMatchersAnnotation] = strings.Join(injectedMatchers, ",")
+	workload.PodTemplate.Annotations[ConfigurationAnnotation] = configuration.key()
+	setTokenHashAnnotation(workload.PodTemplate, configuration.tokenHash)
+
+	state.Matchers = strings.Join(injectedMatchers, ",")
+	setPatchState(workload, state)
+
+	podSpec.Volumes = append(podSpec.Volumes, core.Volume{
+		Name:         configuration.Spec.InitContainer.SharedVolumeName,
+		VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}},
+	})
+
+	podSpec.InitContainers = append(podSpec.InitContainers, core.Container{
+		Image:           configuration.Spec.InitContainer.Image,
+		ImagePullPolicy: configuration.Spec.InitContainer.ImagePullPolicy,
+		Name:            configuration.Spec.InitContainer.ContainerName,
+		VolumeMounts: []core.VolumeMount{
+			{
+				Name:      configuration.Spec.InitContainer.SharedVolumeName,
+				MountPath: configuration.Spec.InitContainer.SharedVolumeMountPath},
+		},
+	})
+}
+
+// The agent is removed whichever configuration injected it, even if that configuration changed or was deleted since
+func removeAgent(workload *Workload) {
+	var updatedContainers []core.Container
+	var updatedInitContainers []core.Container
+	var updatedVolumes []core.Volume
+	state := getPatchState(workload)
+	initContainers := state.injectedInitContainers()
+
+	// Cleaning Env vars & volumeMounts per container
+	for _, container := range workload.PodTemplate.Spec.Containers {
+		var updatedEnvVars []core.EnvVar
+		var updatedVolumeMounts []core.VolumeMount
+
+		for _, initContainer := range initContainers {
+			for _, injector := range runtimeInjectors {
+				container.Env = injector.removeAgentEnvVars(container.Env, initContainer.SharedVolumeMountPath)
+			}
+		}
+
+		for _, envVar := range container.Env {
+			if strings.HasPrefix(envVar.Name, RookoutEnvVarPreffix) {
+				continue
+			}
+
+			updatedEnvVars = append(updatedEnvVars, envVar)
+		}
+
+		for _, volumeMount := range container.VolumeMounts {
+			if !isSharedVolume(initContainers, volumeMount.Name) {
+				updatedVolumeMounts = append(updatedVolumeMounts, volumeMount)
+			}
+		}
+
+		// Env vars we added without the ROOKOUT_ prefix
+		if state != nil {
+			updatedEnvVars = removeEnvVars(updatedEnvVars, state.EnvVars[container.Name])
+		}
+
+		container.Env = updatedEnvVars
+		container.VolumeMounts = updatedVolumeMounts
+		updatedContainers = append(updatedContainers, container)
+	}
+
+	// Removing Rookout volume and init container
+	for _, volume := range workload.PodTemplate.Spec.Volumes {
+		if !isSharedVolume(initContainers, volume.Name) {
+			updatedVolumes = append(updatedVolumes, volume)
+		}
+	}
+
+	for _, container := range workload.PodTemplate.Spec.InitContainers {
+		if !isAgentInitContainer(initContainers, container.Name) {
+			updatedInitContainers = append(updatedInitContainers, container)
+		}
+	}
+
+	workload.PodTemplate.Spec.Containers = updatedContainers
+	workload.PodTemplate.Spec.InitContainers = updatedInitContainers
+	workload.PodTemplate.Spec.Volumes = updatedVolumes
+	delete(workload.PodTemplate.Annotations, InjectedRuntimesAnnotation)
+	delete(workload.PodTemplate.Annotations, InjectedMatchersAnnotation)
+	delete(workload.PodTemplate.Annotations, ConfigurationAnnotation)
+	delete(workload.PodTemplate.Annotations, TokenHashAnnotation)
+	setPatchState(workload, nil)
+}
+
+func doesWorkloadHaveSDKContainer(workload *Workload) bool {
+	initContainers := configurations.InitContainers()
+
+	for _, initContainer := range workload.PodTemplate.Spec.InitContainers {
+		if isAgentInitContainer(initContainers, initContainer.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isAgentInitContainer(initContainers []rookoutv1alpha1.InitContainer, name string) bool {
+	for _, initContainer := range initContainers {
+		if initContainer.ContainerName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSharedVolume(initContainers []rookoutv1alpha1.InitContainer, name string) bool {
+	for _, initContainer := range initContainers {
+		if initContainer.SharedVolumeName == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"testing"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestInjectAndRemoveAgent(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{
+		{
+			Container: "java-container",
+			EnvVars:   []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}},
+		},
+	}}})
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{
+		{Name: "java-container", Env: []v1.EnvVar{{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx1g"}}},
+		{Name: "sidecar"},
+	}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+	assert.True(isWorkloadMatched(configuration, workload))
+
+	injectAgent(configuration, workload)
+	assert.True(doesWorkloadHaveSDKContainer(workload))
+	assert.Len(deployment.Spec.Template.Spec.Containers, 2)
+	assert.Equal([]v1.EnvVar{
+		{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx1g -javaagent:/rookout/rook.jar"},
+		{Name: RookoutTokenEnvVar, Value: "token"},
+	}, deployment.Spec.Template.Spec.Containers[0].Env)
+	assert.Equal(original.Spec.Template.Spec.Containers[1], deployment.Spec.Template.Spec.Containers[1])
+
+	removeAgent(workload)
+	assert.False(doesWorkloadHaveSDKContainer(workload))
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+}
+
+func TestPythonRuntime(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{{Runtime: rookout.PythonRuntime}}}})
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{
+		{Name: "python-container", Env: []v1.EnvVar{{Name: "PYTHONPATH", Value: "/app"}}},
+	}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	injectAgent(configuration, workload)
+	assert.Equal([]v1.EnvVar{{Name: "PYTHONPATH", Value: "/rookout/python:/app"}}, deployment.Spec.Template.Spec.Containers[0].Env)
+
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+}
+
+func TestNodeRuntime(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{{Runtime: rookout.NodeRuntime}}}})
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{
+		{Name: "node-container", Env: []v1.EnvVar{{Name: "NODE_OPTIONS", Value: "--max-old-space-size=4096"}}},
+	}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	injectAgent(configuration, workload)
+	assert.Equal([]v1.EnvVar{
+		{Name: "NODE_OPTIONS", Value: "--max-old-space-size=4096 --require=/rookout/node/auto_start.js"},
+	}, deployment.Spec.Template.Spec.Containers[0].Env)
+
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+}
+
+func TestDotNetRuntime(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{{Runtime: rookout.DotNetRuntime}}}})
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{
+		{Name: "dotnet-container"},
+		{Name: "apm-container", Env: []v1.EnvVar{{Name: "CORECLR_PROFILER", Value: "{APM}"}}},
+	}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	injectAgent(configuration, workload)
+	assert.Equal([]v1.EnvVar{
+		{Name: "DOTNET_STARTUP_HOOKS", Value: "/rookout/dotnet/startup_hook/Rookout.StartupHook.dll"},
+	}, deployment.Spec.Template.Spec.Containers[0].Env)
+	assert.Equal([]v1.EnvVar{
+		{Name: "CORECLR_PROFILER", Value: "{APM}"},
+		{Name: "DOTNET_STARTUP_HOOKS", Value: "/rookout/dotnet/startup_hook/Rookout.StartupHook.dll"},
+	}, deployment.Spec.Template.Spec.Containers[1].Env)
+
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+
+	// Patched by a version which also loaded a CLR profiler
+	injectAgent(configuration, workload)
+	deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env,
+		v1.EnvVar{Name: "CORECLR_ENABLE_PROFILING", Value: "1"},
+		v1.EnvVar{Name: "CORECLR_PROFILER", Value: legacyDotnetProfilerGUID},
+		v1.EnvVar{Name: "CORECLR_PROFILER_PATH", Value: "/rookout/dotnet/profiler/librookout_profiler.so"},
+	)
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+}
+
+func TestExcludeMatchersAndPriority(t *testing.T) {
+	assert := require.New(t)
+
+	token := []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}}
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Scope: rookout.ClusterScope, Matchers: []rookout.Matcher{
+		{Name: "team-x", Namespace: "team-x", NamespaceMatchMode: rookout.ExactMatchMode, EnvVars: token},
+		{Name: "legacy", Deployment: "legacy-", DeploymentMatchMode: rookout.PrefixMatchMode, Exclude: true, Priority: 10},
+		{Container: "worker", EnvVars: token, Priority: 5},
+	}}})
+	assert.True(configuration.isReady)
+
+	deployment := apps.Deployment{}
+	deployment.Namespace = "team-x"
+	deployment.Name = "api"
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}, {Name: "worker"}}
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	// Higher priority matchers win, whatever their order is
+	assert.Equal("app=team-x,worker=#2", describeWorkloadMatchers(configuration, workload))
+
+	injectAgent(configuration, workload)
+	assert.Equal("app=team-x,worker=#2", deployment.Spec.Template.Annotations[InjectedMatchersAnnotation])
+	removeAgent(workload)
+	assert.NotContains(deployment.Spec.Template.Annotations, InjectedMatchersAnnotation)
+
+	// Everything in namespace team-x except legacy deployments
+	deployment.Name = "legacy-api"
+	assert.False(isWorkloadMatched(configuration, workload))
+	_, _, reason := findContainerInjection(configuration, workload, deployment.Spec.Template.Spec.Containers[1])
+	assert.Equal("excluded by matcher legacy", reason)
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	batch "k8s.io/api/batch/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// JobInjector adds rookout's agent to standalone jobs when they are created, since a job's pod template
+// is immutable and can't be patched by the reconciler later on
+type JobInjector struct {
+	// Reads the job's namespace labels, for namespace selectors
+	Reader  client.Reader
+	decoder *admission.Decoder
+}
+
+func (j *JobInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	job := &batch.Job{}
+	err := j.decoder.Decode(req, job)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Objects being created don't always carry their namespace
+	if job.Namespace == "" {
+		job.Namespace = req.Namespace
+	}
+
+	workload, err := newWorkload(job)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	err = setNamespaceLabels(ctx, j.Reader, workload)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// Jobs created by an already patched cronjob
+	if doesWorkloadHaveSDKContainer(workload) {
+		return admission.Allowed("job already has rookout agent")
+	}
+
+	configuration := findWorkloadConfiguration(workload)
+	if configuration == nil {
+		return admission.Allowed("no matcher found for job")
+	}
+
+	// Job pods are instrumented by the pod webhook
+	if configuration.Spec.InjectionMode == rookoutv1alpha1.PodInjectionMode {
+		return admission.Allowed("pod injection mode is used")
+	}
+
+	if configuration.isDryRun() {
+		return admission.Allowed("configuration is in dry run mode")
+	}
+
+	logrus.Infof("Adding rookout agent to %s using configuration %s", workload, configuration.key())
+	injectAgent(configuration, workload)
+
+	marshaledJob, err := json.Marshal(job)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledJob)
+}
+
+func (j *JobInjector) InjectDecoder(decoder *admission.Decoder) error {
+	j.decoder = decoder
+	return nil
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	batch "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// An admission request creating the object, as the API server sends it
+func newTestAdmissionRequest(t *testing.T, namespace string, obj runtime.Object) admission.Request {
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err)
+
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Namespace: namespace,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func newTestDecoder(t *testing.T) *admission.Decoder {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	require.NoError(t, err)
+	return decoder
+}
+
+func TestJobInjector(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{WorkloadKinds: []rookout.WorkloadKind{rookout.JobKind}})
+	configurations.Update(newOperatorConfiguration(config))
+
+	injector := &JobInjector{Reader: newTestReconciler(t).Client}
+	assert.NoError(injector.InjectDecoder(newTestDecoder(t)))
+
+	job := &batch.Job{}
+	job.Name = "migrate"
+	job.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+
+	// The namespace is only on the request
+	response := injector.Handle(ctx, newTestAdmissionRequest(t, "default", job))
+	assert.True(response.Allowed)
+	assert.NotEmpty(response.Patches)
+	paths := map[string]bool{}
+	for _, operation := range response.Patches {
+		paths[operation.Path] = true
+	}
+	assert.True(paths["/spec/template/spec/initContainers"])
+
+	// Created by an already patched cronjob
+	workload, err := newWorkload(job)
+	assert.NoError(err)
+	injectAgent(configurations.List()[0], workload)
+	response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", job))
+	assert.True(response.Allowed)
+	assert.Empty(response.Patches)
+	assert.Equal("job already has rookout agent", string(response.Result.Reason))
+
+	job.Spec.Template.Spec = v1.PodSpec{Containers: []v1.Container{{Name: "app"}}}
+	for _, testCase := range []struct {
+		mode           rookout.InjectionMode
+		operatorMode   rookout.OperatorMode
+		kinds          []rookout.WorkloadKind
+		expectedReason string
+	}{
+		{kinds: nil, expectedReason: "no matcher found for job"},
+		{kinds: []rookout.WorkloadKind{rookout.JobKind}, mode: rookout.PodInjectionMode, expectedReason: "pod injection mode is used"},
+		{kinds: []rookout.WorkloadKind{rookout.JobKind}, operatorMode: rookout.DryRunOperatorMode, expectedReason: "configuration is in dry run mode"},
+	} {
+		config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{WorkloadKinds: testCase.kinds})
+		config.Spec.InjectionMode = testCase.mode
+		config.Spec.Mode = testCase.operatorMode
+		configurations.Update(newOperatorConfiguration(config))
+
+		response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", job))
+		assert.True(response.Allowed)
+		assert.Empty(response.Patches)
+		assert.Equal(testCase.expectedReason, string(response.Result.Reason))
+	}
+}
@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"fmt"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/rookout/rookout-k8s-operator/api/v1alpha1"
 	"github.com/sirupsen/logrus"
-	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
-	ctrl "sigs.k8s.io/controller-runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func setRookoutEnvVars(env *[]core.EnvVar, evnVars []core.EnvVar) {
@@ -21,18 +24,157 @@ func setRookoutEnvVars(env *[]core.EnvVar, evnVars []core.EnvVar) {
 	}
 }
 
-func labelsMatch(matcher v1alpha1.Matcher, deployment apps.Deployment) bool {
-	for expectedLabelName, expectedLabelValue := range matcher.Labels {
-		labelMatched := false
+// Matcher with its name patterns compiled, built once when the configuration is loaded
+type compiledMatcher struct {
+	v1alpha1.Matcher
+	// Matcher name, or its index in the configuration when it has no name
+	id         string
+	container  namePattern
+	deployment namePattern
+	namespace  namePattern
+	image      namePattern
+	imageTag   namePattern
+	// Labels and selector combined
+	selector          labels.Selector
+	namespaceSelector labels.Selector
+	podSelector       labels.Selector
+}
+
+type namePattern struct {
+	value string
+	mode  v1alpha1.MatchMode
+	// Only set in regex mode
+	regex *regexp.Regexp
+}
+
+func compileMatcher(matcher v1alpha1.Matcher) (*compiledMatcher, error) {
+	var err error
+	compiled := &compiledMatcher{Matcher: matcher}
+
+	compiled.container, err = newNamePattern(matcher.Container, matcher.ContainerMatchMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container pattern: %w", err)
+	}
+
+	compiled.deployment, err = newNamePattern(matcher.Deployment, matcher.DeploymentMatchMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deployment pattern: %w", err)
+	}
+
+	compiled.namespace, err = newNamePattern(matcher.Namespace, matcher.NamespaceMatchMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace pattern: %w", err)
+	}
+
+	compiled.image, err = newNamePattern(matcher.Image, matcher.ImageMatchMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image pattern: %w", err)
+	}
+
+	compiled.imageTag, err = newNamePattern(matcher.ImageTag, matcher.ImageTagMatchMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image tag pattern: %w", err)
+	}
+
+	compiled.selector, err = newLabelSelector(matcher.Labels, matcher.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	compiled.namespaceSelector, err = newLabelSelector(nil, matcher.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector: %w", err)
+	}
+
+	compiled.podSelector, err = newLabelSelector(nil, matcher.PodSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pod selector: %w", err)
+	}
+
+	return compiled, nil
+}
+
+func newNamePattern(value string, mode v1alpha1.MatchMode) (namePattern, error) {
+	pattern := namePattern{value: value, mode: v1alpha1.MatchMode(getConfigStr(string(mode), string(v1alpha1.ContainsMatchMode)))}
 
-		for labelName, labelValue := range deployment.Labels {
-			if labelName == expectedLabelName && labelValue == expectedLabelValue {
-				labelMatched = true
-				break
-			}
+	switch pattern.mode {
+	case v1alpha1.GlobMatchMode:
+		if _, err := path.Match(value, ""); err != nil {
+			return pattern, err
 		}
+	case v1alpha1.RegexMatchMode:
+		// Anchored, the regex has to match the whole name
+		regex, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return pattern, err
+		}
+		pattern.regex = regex
+	}
+
+	return pattern, nil
+}
+
+// The matcher's labels are added to the selector as "In" requirements, no labels and no selector select everything
+func newLabelSelector(matchLabels map[string]string, selector *metav1.LabelSelector) (labels.Selector, error) {
+	combined := &metav1.LabelSelector{}
+	if selector != nil {
+		combined = selector.DeepCopy()
+	}
+
+	for key, value := range matchLabels {
+		combined.MatchExpressions = append(combined.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      key,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   []string{value},
+		})
+	}
+
+	return metav1.LabelSelectorAsSelector(combined)
+}
+
+// An empty pattern matches any name
+func (p namePattern) match(name string) bool {
+	if p.value == "" {
+		return true
+	}
+
+	switch p.mode {
+	case v1alpha1.ExactMatchMode:
+		return name == p.value
+	case v1alpha1.PrefixMatchMode:
+		return strings.HasPrefix(name, p.value)
+	case v1alpha1.GlobMatchMode:
+		matched, _ := path.Match(p.value, name)
+		return matched
+	case v1alpha1.RegexMatchMode:
+		return p.regex.MatchString(name)
+	}
+
+	return strings.Contains(name, p.value)
+}
+
+func workloadMatch(matcher *compiledMatcher, workload *Workload) bool {
+	return workloadKindMatch(matcher, workload) && deploymentMatch(matcher, workload) && namespaceMatch(matcher, workload) &&
+		labelsMatch(matcher, workload) && namespaceSelectorMatch(matcher, workload) && podTemplateMatch(matcher, workload)
+}
+
+func labelsMatch(matcher *compiledMatcher, workload *Workload) bool {
+	return matcher.selector.Matches(labels.Set(workload.GetLabels()))
+}
+
+// Namespace labels are only read when a configuration uses a namespace selector
+func namespaceSelectorMatch(matcher *compiledMatcher, workload *Workload) bool {
+	return matcher.NamespaceSelector == nil || matcher.namespaceSelector.Matches(labels.Set(workload.NamespaceLabels))
+}
 
-		if !labelMatched {
+// Pod template labels are matched by the pod selector, the pod annotations must all be set with the same values
+func podTemplateMatch(matcher *compiledMatcher, workload *Workload) bool {
+	if !matcher.podSelector.Matches(labels.Set(workload.PodTemplate.Labels)) {
+		return false
+	}
+
+	for key, value := range matcher.PodAnnotations {
+		if actual, ok := workload.PodTemplate.Annotations[key]; !ok || actual != value {
 			return false
 		}
 	}
@@ -40,30 +182,34 @@ func labelsMatch(matcher v1alpha1.Matcher, deployment apps.Deployment) bool {
 	return true
 }
 
-func namespaceMatch(matcher v1alpha1.Matcher, deployment apps.Deployment) bool {
-	return matcher.Namespace == "" || strings.Contains(deployment.GetNamespace(), matcher.Namespace)
-}
-
-func deploymentMatch(matcher v1alpha1.Matcher, deployment apps.Deployment) bool {
-	return matcher.Deployment == "" || strings.Contains(deployment.Name, matcher.Deployment)
+func namespaceMatch(matcher *compiledMatcher, workload *Workload) bool {
+	return matcher.namespace.match(workload.GetNamespace())
 }
 
-func containerMatch(matcher v1alpha1.Matcher, container core.Container) bool {
-	return matcher.Container == "" || strings.Contains(container.Name, matcher.Container)
+func deploymentMatch(matcher *compiledMatcher, workload *Workload) bool {
+	return matcher.deployment.match(workload.GetName())
 }
 
-const (
-	OperatorConfigurationResource = "Rookout"
-	DeploymentResource            = "Deployment"
-	ConfigurationResourceName     = "rookout-operator-configuration"
-)
+func workloadKindMatch(matcher *compiledMatcher, workload *Workload) bool {
+	if len(matcher.WorkloadKinds) == 0 {
+		return workload.Kind == v1alpha1.DeploymentKind
+	}
 
-func getResourceType(req ctrl.Request) string {
-	if req.Name == ConfigurationResourceName {
-		return OperatorConfigurationResource
+	for _, kind := range matcher.WorkloadKinds {
+		if kind == workload.Kind {
+			return true
+		}
 	}
 
-	return DeploymentResource
+	return false
+}
+
+func containerMatch(matcher *compiledMatcher, container core.Container) bool {
+	return matcher.container.match(container.Name)
+}
+
+func imageMatch(matcher *compiledMatcher, container core.Container) bool {
+	return matcher.image.match(imageRepository(container.Image)) && matcher.imageTag.match(imageTag(container.Image))
 }
 
 func getConfigStr(config string, defaultValue string) string {
@@ -82,3 +228,12 @@ func removeElementWithSuffix(s []string, suffix string) []string {
 	}
 	return s
 }
+
+func containsString(s []string, value string) bool {
+	for _, v := range s {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
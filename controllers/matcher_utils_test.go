@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/require"
 	apps "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestMatcher(t *testing.T) {
@@ -21,30 +22,204 @@ func TestMatcher(t *testing.T) {
 		},
 	}
 	deployment.Namespace = "right-namespace"
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
 
-	rightMatcher := rookout.Matcher{
+	rightMatcher, err := compileMatcher(rookout.Matcher{
 		Deployment: "right-deployment",
 		Container:  "right-container",
 		Labels:     map[string]string{"app": "right_app"},
 		Namespace:  "right-namespace",
-	}
-	wrongMatcher := rookout.Matcher{
+	})
+	assert.NoError(err)
+	wrongMatcher, err := compileMatcher(rookout.Matcher{
 		Deployment: "wrong-deployment",
 		Container:  "wrong-container",
 		Labels:     map[string]string{"app": "wrong_app"},
 		Namespace:  "wrong-namespace",
-	}
+	})
+	assert.NoError(err)
 
-	assert.True(deploymentMatch(rightMatcher, deployment))
+	assert.True(deploymentMatch(rightMatcher, workload))
 	assert.True(containerMatch(rightMatcher, deployment.Spec.Template.Spec.Containers[0]))
-	assert.True(labelsMatch(rightMatcher, deployment))
-	assert.True(namespaceMatch(rightMatcher, deployment))
+	assert.True(labelsMatch(rightMatcher, workload))
+	assert.True(namespaceMatch(rightMatcher, workload))
 
-	assert.False(deploymentMatch(wrongMatcher, deployment))
+	assert.False(deploymentMatch(wrongMatcher, workload))
 	assert.False(containerMatch(wrongMatcher, deployment.Spec.Template.Spec.Containers[0]))
-	assert.False(labelsMatch(wrongMatcher, deployment))
-	assert.False(namespaceMatch(wrongMatcher, deployment))
+	assert.False(labelsMatch(wrongMatcher, workload))
+	assert.False(namespaceMatch(wrongMatcher, workload))
+
+}
+
+func TestWorkloadKindMatcher(t *testing.T) {
+	assert := require.New(t)
+
+	deployment, err := newWorkload(&apps.Deployment{})
+	assert.NoError(err)
+	statefulSet, err := newWorkload(&apps.StatefulSet{})
+	assert.NoError(err)
+	daemonSet, err := newWorkload(&apps.DaemonSet{})
+	assert.NoError(err)
+
+	defaultMatcher, err := compileMatcher(rookout.Matcher{})
+	assert.NoError(err)
+	statefulSetMatcher, err := compileMatcher(rookout.Matcher{WorkloadKinds: []rookout.WorkloadKind{rookout.StatefulSetKind}})
+	assert.NoError(err)
+
+	assert.True(workloadKindMatch(defaultMatcher, deployment))
+	assert.False(workloadKindMatch(defaultMatcher, statefulSet))
+
+	assert.False(workloadKindMatch(statefulSetMatcher, deployment))
+	assert.True(workloadKindMatch(statefulSetMatcher, statefulSet))
+	assert.False(workloadKindMatch(statefulSetMatcher, daemonSet))
+	assert.False(workloadKindMatch(defaultMatcher, daemonSet))
+}
+
+func TestMatchModes(t *testing.T) {
+	assert := require.New(t)
+
+	deployment := apps.Deployment{}
+	deployment.Name = "payments-api-legacy"
+	deployment.Namespace = "team-payments"
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+	container := v1.Container{Name: "api-server"}
+
+	for _, testCase := range []struct {
+		mode    rookout.MatchMode
+		pattern string
+		matched bool
+	}{
+		{"", "api", true},
+		{rookout.ContainsMatchMode, "api", true},
+		{rookout.ExactMatchMode, "api", false},
+		{rookout.ExactMatchMode, "payments-api-legacy", true},
+		{rookout.PrefixMatchMode, "api", false},
+		{rookout.PrefixMatchMode, "payments-", true},
+		{rookout.GlobMatchMode, "*-api", false},
+		{rookout.GlobMatchMode, "payments-*", true},
+		{rookout.GlobMatchMode, "payments-ap?-*", true},
+		{rookout.RegexMatchMode, "api", false},
+		{rookout.RegexMatchMode, "payments-api(-.*)?", true},
+		{rookout.RegexMatchMode, "payments-(?:web|worker)", false},
+	} {
+		matcher, err := compileMatcher(rookout.Matcher{Deployment: testCase.pattern, DeploymentMatchMode: testCase.mode})
+		assert.NoError(err)
+		assert.Equal(testCase.matched, deploymentMatch(matcher, workload), "%s %s", testCase.mode, testCase.pattern)
+	}
+
+	matcher, err := compileMatcher(rookout.Matcher{
+		Container:          "api-*",
+		ContainerMatchMode: rookout.GlobMatchMode,
+		Namespace:          "team-.+",
+		NamespaceMatchMode: rookout.RegexMatchMode,
+	})
+	assert.NoError(err)
+	assert.True(containerMatch(matcher, container))
+	assert.True(namespaceMatch(matcher, workload))
+	assert.False(containerMatch(matcher, v1.Container{Name: "sidecar-api-server"}))
+
+	exactMatcher, err := compileMatcher(rookout.Matcher{Container: "api", ContainerMatchMode: rookout.ExactMatchMode, Namespace: "team", NamespaceMatchMode: rookout.PrefixMatchMode})
+	assert.NoError(err)
+	assert.False(containerMatch(exactMatcher, container))
+	assert.True(namespaceMatch(exactMatcher, workload))
 
+	_, err = compileMatcher(rookout.Matcher{Namespace: "team-(", NamespaceMatchMode: rookout.RegexMatchMode})
+	assert.Error(err)
+	_, err = compileMatcher(rookout.Matcher{Container: "[", ContainerMatchMode: rookout.GlobMatchMode})
+	assert.Error(err)
+
+	// Invalid patterns make the configuration not ready
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{
+		{Deployment: "(", DeploymentMatchMode: rookout.RegexMatchMode, EnvVars: []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}}},
+	}}})
+	assert.False(configuration.isReady)
+	assert.Equal("InvalidMatcher", configuration.readyReason)
+}
+
+func TestLabelSelectors(t *testing.T) {
+	assert := require.New(t)
+
+	deployment := apps.Deployment{}
+	deployment.Labels = map[string]string{"app": "api", "team": "payments"}
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	for _, testCase := range []struct {
+		labels  map[string]string
+		matcher *metav1.LabelSelector
+		matched bool
+	}{
+		{nil, nil, true},
+		{map[string]string{"app": "api"}, nil, true},
+		{map[string]string{"app": "web"}, nil, false},
+		{nil, &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}, true},
+		{nil, &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpIn, Values: []string{"api", "web"}}}}, true},
+		{nil, &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"api"}}}}, false},
+		{nil, &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: metav1.LabelSelectorOpExists}}}, true},
+		{nil, &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "legacy", Operator: metav1.LabelSelectorOpDoesNotExist}}}, true},
+		// Labels and selector are ANDed
+		{map[string]string{"app": "web"}, &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}, false},
+	} {
+		matcher, err := compileMatcher(rookout.Matcher{Labels: testCase.labels, Selector: testCase.matcher})
+		assert.NoError(err)
+		assert.Equal(testCase.matched, labelsMatch(matcher, workload), "%v %v", testCase.labels, testCase.matcher)
+	}
+
+	// All namespaces labelled env=staging except tier=critical
+	matcher, err := compileMatcher(rookout.Matcher{NamespaceSelector: &metav1.LabelSelector{
+		MatchLabels:      map[string]string{"env": "staging"},
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"critical"}}},
+	}})
+	assert.NoError(err)
+
+	workload.NamespaceLabels = map[string]string{"env": "staging"}
+	assert.True(namespaceSelectorMatch(matcher, workload))
+	workload.NamespaceLabels = map[string]string{"env": "staging", "tier": "critical"}
+	assert.False(namespaceSelectorMatch(matcher, workload))
+	workload.NamespaceLabels = map[string]string{"env": "production"}
+	assert.False(namespaceSelectorMatch(matcher, workload))
+
+	_, err = compileMatcher(rookout.Matcher{Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpIn}}}})
+	assert.Error(err)
+}
+
+func TestPodTemplateAndImageMatch(t *testing.T) {
+	assert := require.New(t)
+
+	deployment := apps.Deployment{}
+	deployment.Name = "checkout"
+	deployment.Spec.Template.Labels = map[string]string{"app": "checkout", "tier": "backend"}
+	deployment.Spec.Template.Annotations = map[string]string{"example.com/debuggable": "true"}
+	container := v1.Container{Name: "app", Image: "registry/payments/checkout:1.4.2"}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{container}
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	for _, testCase := range []struct {
+		matcher rookout.Matcher
+		matched bool
+	}{
+		{rookout.Matcher{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "backend"}}}, true},
+		{rookout.Matcher{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "frontend"}}}, false},
+		// Workload labels aren't pod template labels
+		{rookout.Matcher{Labels: map[string]string{"tier": "backend"}}, false},
+		{rookout.Matcher{PodAnnotations: map[string]string{"example.com/debuggable": "true"}}, true},
+		{rookout.Matcher{PodAnnotations: map[string]string{"example.com/debuggable": "false"}}, false},
+		{rookout.Matcher{Image: "registry/payments/*", ImageMatchMode: rookout.GlobMatchMode}, true},
+		{rookout.Matcher{Image: "registry/payments/", ImageMatchMode: rookout.PrefixMatchMode}, true},
+		{rookout.Matcher{Image: "registry/orders/*", ImageMatchMode: rookout.GlobMatchMode}, false},
+		// The tag isn't part of the repository
+		{rookout.Matcher{Image: "registry/payments/checkout", ImageMatchMode: rookout.ExactMatchMode}, true},
+		{rookout.Matcher{ImageTag: `1\.4\..*`, ImageTagMatchMode: rookout.RegexMatchMode}, true},
+		{rookout.Matcher{Image: "payments", ImageTag: "latest", ImageTagMatchMode: rookout.ExactMatchMode}, false},
+	} {
+		matcher, err := compileMatcher(testCase.matcher)
+		assert.NoError(err)
+		matched := workloadMatch(matcher, workload) && imageMatch(matcher, container)
+		assert.Equal(testCase.matched, matched, "%+v", testCase.matcher)
+	}
 }
 
 func TestEnvVarSet(t *testing.T) {
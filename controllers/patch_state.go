@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+)
+
+// Set on workloads patched by the operator (not on their pod template, changing it doesn't roll out the workload),
+// holds what was injected so restarts, leader failover and unpatching only depend on the cluster state
+const PatchStateAnnotation = "rookout.com/patch-state"
+
+type patchState struct {
+	// Hash of the spec of the configuration used to patch the workload
+	ConfigHash string `json:"config_hash"`
+	// container=matcher ID of every instrumented container
+	Matchers string `json:"matchers,omitempty"`
+	// Names of the env vars added to each container, env vars which already existed (like JAVA_TOOL_OPTIONS) aren't listed
+	EnvVars map[string][]string `json:"env_vars,omitempty"`
+	// Tag of the init container image
+	AgentVersion string `json:"agent_version"`
+	// Names of the injected init container and shared volume and where the volume is mounted, the configuration might
+	// have changed them (or been deleted) since
+	InitContainerName     string `json:"init_container_name,omitempty"`
+	SharedVolumeName      string `json:"shared_volume_name,omitempty"`
+	SharedVolumeMountPath string `json:"shared_volume_mount_path,omitempty"`
+}
+
+// The init containers the agent might have been injected with: the one recorded on the workload, or those of the
+// current configurations (and the default one) when the state doesn't record it
+func (s *patchState) injectedInitContainers() []rookoutv1alpha1.InitContainer {
+	if s == nil || s.InitContainerName == "" {
+		return configurations.InitContainers()
+	}
+
+	return []rookoutv1alpha1.InitContainer{{
+		ContainerName:         s.InitContainerName,
+		SharedVolumeName:      s.SharedVolumeName,
+		SharedVolumeMountPath: s.SharedVolumeMountPath,
+	}}
+}
+
+func hashConfigurationSpec(spec rookoutv1alpha1.RookoutSpec) string {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		logrus.Errorf("Failed to hash configuration spec: %v", err)
+		return ""
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+}
+
+// Returns nil when the workload wasn't patched by the operator (or was patched by a version which didn't record it)
+func getPatchState(workload *Workload) *patchState {
+	value, ok := workload.GetAnnotations()[PatchStateAnnotation]
+	if !ok {
+		return nil
+	}
+
+	state := &patchState{}
+	if err := json.Unmarshal([]byte(value), state); err != nil {
+		logrus.Warnf("Ignoring invalid %s annotation of %s: %v", PatchStateAnnotation, workload, err)
+		return nil
+	}
+
+	return state
+}
+
+func setPatchState(workload *Workload, state *patchState) {
+	annotations := workload.GetAnnotations()
+
+	if state == nil {
+		delete(annotations, PatchStateAnnotation)
+		workload.SetAnnotations(annotations)
+		return
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		logrus.Errorf("Failed to record patch state of %s: %v", workload, err)
+		return
+	}
+
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[PatchStateAnnotation] = string(data)
+	workload.SetAnnotations(annotations)
+}
+
+func isWorkloadPatched(workload *Workload) bool {
+	return getPatchState(workload) != nil || doesWorkloadHaveSDKContainer(workload)
+}
+
+// Names of the env vars of the container which aren't in the given list
+func addedEnvVarNames(existing []core.EnvVar, env []core.EnvVar) []string {
+	var names []string
+	for _, envVar := range env {
+		if findEnvVar(existing, envVar.Name) == nil {
+			names = append(names, envVar.Name)
+		}
+	}
+
+	return names
+}
+
+func removeEnvVars(env []core.EnvVar, names []string) []core.EnvVar {
+	var updatedEnvVars []core.EnvVar
+	for _, envVar := range env {
+		if !containsString(names, envVar.Name) {
+			updatedEnvVars = append(updatedEnvVars, envVar)
+		}
+	}
+
+	return updatedEnvVars
+}
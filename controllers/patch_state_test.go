@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"testing"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPatchState(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{
+		InitContainer: rookout.InitContainer{Image: "rookout/agents-init-container:0.12.0"},
+		Matchers: []rookout.Matcher{
+			{Name: "java", EnvVars: []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}}},
+		},
+	}})
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{
+		{Name: "app"},
+		{Name: "legacy", Env: []v1.EnvVar{{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx1g"}}},
+	}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+	assert.Nil(getPatchState(workload))
+	assert.False(isWorkloadPatched(workload))
+
+	injectAgent(configuration, workload)
+	assert.True(isWorkloadPatched(workload))
+	assert.Equal(&patchState{
+		ConfigHash: configuration.configHash,
+		Matchers:   "app=java,legacy=java",
+		// JAVA_TOOL_OPTIONS already existed in the legacy container
+		EnvVars: map[string][]string{
+			"app":    {RookoutTokenEnvVar, "JAVA_TOOL_OPTIONS"},
+			"legacy": {RookoutTokenEnvVar},
+		},
+		AgentVersion:          "0.12.0",
+		InitContainerName:     DefaultInitContainerName,
+		SharedVolumeName:      DefaultSharedVolumeName,
+		SharedVolumeMountPath: DefaultSharedVolumeMountPath,
+	}, getPatchState(workload))
+
+	// Only the state recorded on the workload is needed to unpatch it
+	removeAgent(workload)
+	assert.Nil(getPatchState(workload))
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+
+	// The hash changes with the configuration
+	configuration.Spec.InjectionMode = rookout.PodInjectionMode
+	assert.NotEqual(configuration.configHash, hashConfigurationSpec(configuration.Spec))
+
+	deployment.Annotations = map[string]string{PatchStateAnnotation: "not json"}
+	assert.Nil(getPatchState(workload))
+}
+
+func TestPatchStateInitContainer(t *testing.T) {
+	assert := require.New(t)
+	useTestConfigurations(t)
+
+	config := rookout.Rookout{Spec: rookout.RookoutSpec{
+		InitContainer: rookout.InitContainer{ContainerName: "custom-init", SharedVolumeName: "custom-vol", SharedVolumeMountPath: "/custom"},
+		Matchers:      []rookout.Matcher{{Name: "java"}},
+	}}
+	configuration := newOperatorConfiguration(config)
+	configurations.Update(configuration)
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+	injectAgent(configuration, workload)
+
+	// The names changed since the workload was patched, the re-patch replaces the injected init container and volume
+	config.Spec.InitContainer = rookout.InitContainer{ContainerName: "renamed-init", SharedVolumeName: "renamed-vol"}
+	configuration = newOperatorConfiguration(config)
+	configurations.Update(configuration)
+
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+
+	injectAgent(configuration, workload)
+	assert.Len(deployment.Spec.Template.Spec.InitContainers, 1)
+	assert.Equal("renamed-init", deployment.Spec.Template.Spec.InitContainers[0].Name)
+	assert.Len(deployment.Spec.Template.Spec.Volumes, 1)
+	assert.Equal([]v1.VolumeMount{{Name: "renamed-vol", MountPath: DefaultSharedVolumeMountPath}}, deployment.Spec.Template.Spec.Containers[0].VolumeMounts)
+
+	// Neither the configuration nor its names are known anymore
+	configurations.Remove(types.NamespacedName{})
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+}
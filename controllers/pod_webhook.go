@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PodInjector adds rookout's agent to pods when they are created (pod injection mode).
+// Matchers are evaluated against the workload owning the pod, exactly like when patching the workload itself,
+// but only the pod is modified so the workload doesn't roll out or drift from its source
+type PodInjector struct {
+	// Reads the pod's owners and namespace labels, the cache is used when possible since every pod goes through the webhook
+	Reader  client.Reader
+	decoder *admission.Decoder
+}
+
+// +kubebuilder:rbac:groups="apps",resources=replicasets,verbs=get;watch;list
+// +kubebuilder:rbac:groups="batch",resources=jobs,verbs=get;watch;list
+
+func (p *PodInjector) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if !configurations.IsAnyReady() {
+		return admission.Allowed("operator configuration is not ready")
+	}
+
+	pod := &core.Pod{}
+	err := p.decoder.Decode(req, pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Objects being created don't always carry their namespace
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+
+	owner, err := p.findPodWorkload(ctx, pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if owner == nil {
+		return admission.Allowed("pod isn't owned by a supported workload")
+	}
+
+	workload, err := newWorkload(owner)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	err = setNamespaceLabels(ctx, p.Reader, workload)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// Matching against the owner, injecting into the pod
+	workload.PodTemplate = &core.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec}
+
+	if doesWorkloadHaveSDKContainer(workload) {
+		return admission.Allowed("pod already has rookout agent")
+	}
+
+	if _, ok := getQuarantineReason(workload); ok {
+		return admission.Allowed("workload is quarantined")
+	}
+
+	configuration := findWorkloadConfiguration(workload)
+	if configuration == nil {
+		return admission.Allowed("no matcher found for pod")
+	}
+
+	if configuration.Spec.InjectionMode != rookoutv1alpha1.PodInjectionMode {
+		return admission.Allowed("workload injection mode is used")
+	}
+
+	if configuration.isDryRun() {
+		return admission.Allowed("configuration is in dry run mode")
+	}
+
+	logrus.Infof("Adding rookout agent to pod of %s using configuration %s", workload, configuration.key())
+	injectAgent(configuration, workload)
+	pod.Spec = workload.PodTemplate.Spec
+	pod.Annotations = workload.PodTemplate.Annotations
+
+	marshaledPod, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+}
+
+// Follows the controller owner references of the pod up to a supported workload (pod -> replicaset -> deployment),
+// returns nil if the pod isn't owned by one
+func (p *PodInjector) findPodWorkload(ctx context.Context, pod *core.Pod) (client.Object, error) {
+	var current client.Object = pod
+
+	for {
+		ownerRef := metav1.GetControllerOf(current)
+		if ownerRef == nil {
+			break
+		}
+
+		var owner client.Object
+		if ownerRef.Kind == "ReplicaSet" {
+			owner = &apps.ReplicaSet{}
+		} else {
+			var err error
+			owner, err = newWorkloadObject(rookoutv1alpha1.WorkloadKind(ownerRef.Kind))
+			if err != nil {
+				return nil, nil
+			}
+		}
+
+		err := p.Reader.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: ownerRef.Name}, owner)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		current = owner
+	}
+
+	// Bare pods and replicasets are not supported
+	if _, err := newWorkload(current); err != nil {
+		return nil, nil
+	}
+
+	return current, nil
+}
+
+func (p *PodInjector) InjectDecoder(decoder *admission.Decoder) error {
+	p.decoder = decoder
+	return nil
+}
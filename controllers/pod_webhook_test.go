@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestOwnerReference(kind string, obj client.Object) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{APIVersion: "apps/v1", Kind: kind, Name: obj.GetName(), UID: obj.GetUID(), Controller: &controller}
+}
+
+func TestPodInjector(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Spec.InjectionMode = rookout.PodInjectionMode
+	configurations.Update(newOperatorConfiguration(config))
+
+	deployment := newTestDeployment("default", "api")
+	replicaSet := &apps.ReplicaSet{}
+	replicaSet.Namespace = "default"
+	replicaSet.Name = "api-5d8f9"
+	replicaSet.OwnerReferences = []metav1.OwnerReference{newTestOwnerReference("Deployment", deployment)}
+
+	newPod := func() *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Name = "api-5d8f9-x2k4q"
+		pod.OwnerReferences = []metav1.OwnerReference{newTestOwnerReference("ReplicaSet", replicaSet)}
+		pod.Spec.Containers = []v1.Container{{Name: "app"}}
+		return pod
+	}
+
+	// The replicaset was just created and isn't cached yet
+	cache := newTestReconciler(t, deployment).Client
+	apiReader := newTestReconciler(t, deployment, replicaSet).Client
+	injector := &PodInjector{Reader: &cacheFirstReader{cache: cache, apiReader: apiReader}}
+	assert.NoError(injector.InjectDecoder(newTestDecoder(t)))
+
+	owner, err := injector.findPodWorkload(ctx, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", OwnerReferences: newPod().OwnerReferences}})
+	assert.NoError(err)
+	assert.Equal("api", owner.GetName())
+
+	response := injector.Handle(ctx, newTestAdmissionRequest(t, "default", newPod()))
+	assert.True(response.Allowed)
+	assert.NotEmpty(response.Patches)
+
+	bare := newPod()
+	bare.OwnerReferences = nil
+	response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", bare))
+	assert.Equal("pod isn't owned by a supported workload", string(response.Result.Reason))
+
+	orphan := newPod()
+	orphan.OwnerReferences[0].Name = "deleted"
+	response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", orphan))
+	assert.Equal("pod isn't owned by a supported workload", string(response.Result.Reason))
+
+	patched := newPod()
+	workload, err := newWorkload(deployment.DeepCopy())
+	assert.NoError(err)
+	injectAgent(configurations.List()[0], workload)
+	patched.Spec = workload.PodTemplate.Spec
+	response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", patched))
+	assert.Equal("pod already has rookout agent", string(response.Result.Reason))
+	assert.Empty(response.Patches)
+
+	config.Spec.Mode = rookout.DryRunOperatorMode
+	configurations.Update(newOperatorConfiguration(config))
+	response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", newPod()))
+	assert.Equal("configuration is in dry run mode", string(response.Result.Reason))
+	assert.Empty(response.Patches)
+
+	config.Spec.Mode = ""
+	configurations.Update(newOperatorConfiguration(config))
+	quarantined := deployment.DeepCopy()
+	quarantined.Annotations = map[string]string{QuarantineAnnotation: "rollout failed"}
+	assert.NoError(cache.Update(ctx, quarantined))
+	response = injector.Handle(ctx, newTestAdmissionRequest(t, "default", newPod()))
+	assert.Equal("workload is quarantined", string(response.Result.Reason))
+	assert.Empty(response.Patches)
+}
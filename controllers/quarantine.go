@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Set on workloads which became unhealthy once patched, holds the reason. The agent was removed from them and they
+// aren't patched again until the annotation is removed
+const QuarantineAnnotation = "rookout.com/quarantined"
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list
+
+func getQuarantineReason(workload *Workload) (string, bool) {
+	reason, ok := workload.GetAnnotations()[QuarantineAnnotation]
+	return reason, ok
+}
+
+func workloadPodSelector(workload *Workload) *metav1.LabelSelector {
+	switch typed := workload.Object.(type) {
+	case *apps.Deployment:
+		return typed.Spec.Selector
+	case *apps.StatefulSet:
+		return typed.Spec.Selector
+	case *apps.DaemonSet:
+		return typed.Spec.Selector
+	}
+
+	return nil
+}
+
+// Returns why the patched workload is unhealthy: its rollout failed (progress deadline exceeded) or one of its
+// instrumented pods is crash looping. Pods are only checked while the workload is rolling out
+func (r *RookoutReconciler) checkWorkloadHealth(ctx context.Context, workload *Workload) (string, error) {
+	done, failure := workloadRolloutStatus(workload, true)
+	if failure != "" {
+		return "rollout failed: " + failure, nil
+	}
+
+	podSelector := workloadPodSelector(workload)
+	if done || podSelector == nil {
+		return "", nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(podSelector)
+	if err != nil {
+		return "", err
+	}
+
+	pods := &core.PodList{}
+	// Caching every pod of the cluster isn't worth it
+	err = r.uncachedReader().List(ctx, pods, client.InNamespace(workload.GetNamespace()), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods.Items {
+		// Pods of the previous template
+		if _, ok := pod.Annotations[ConfigurationAnnotation]; !ok {
+			continue
+		}
+
+		for _, statuses := range [][]core.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+			for _, status := range statuses {
+				if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+					return fmt.Sprintf("container %s of pod %s is in CrashLoopBackOff", status.Name, pod.Name), nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// Removes the agent from the workload right away (whatever the rollout policy) and marks it as quarantined
+func (r *RookoutReconciler) quarantineWorkload(ctx context.Context, workload *Workload, reason string) error {
+	if r.DryRun {
+		logrus.Errorf("Dry run, not quarantining unhealthy %s, %s", workload, reason)
+		return nil
+	}
+
+	originalWorkload := workload.Object.DeepCopyObject().(client.Object)
+	logrus.Errorf("Removing rookout agent from unhealthy %s and quarantining it, %s", workload, reason)
+
+	removeAgent(workload)
+	annotations := workload.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[QuarantineAnnotation] = reason
+	workload.SetAnnotations(annotations)
+
+	return r.Client.Patch(ctx, workload.Object, client.MergeFrom(originalWorkload))
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestQuarantine(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	useTestConfigurations(t)
+
+	configuration := newOperatorConfiguration(newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{}))
+	configurations.Update(configuration)
+
+	labels := map[string]string{"app": "api"}
+	deployment := newTestDeployment("default", "api")
+	deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	deployment.Spec.Template.Labels = labels
+	original := deployment.DeepCopy()
+
+	reconciler := newTestReconciler(t, deployment)
+	getWorkload := func() *Workload {
+		return getTestWorkload(t, reconciler, "default", "api")
+	}
+
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.True(isWorkloadPatched(getWorkload()))
+
+	// Healthy pods, the agent is kept
+	healthyPod := &v1.Pod{}
+	healthyPod.Namespace = "default"
+	healthyPod.Name = "api-healthy"
+	healthyPod.Labels = labels
+	healthyPod.Annotations = map[string]string{ConfigurationAnnotation: configuration.key()}
+	healthyPod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "app", Ready: true}}
+	assert.NoError(reconciler.Client.Create(ctx, healthyPod))
+
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.True(isWorkloadPatched(getWorkload()))
+
+	crashingPod := healthyPod.DeepCopy()
+	crashingPod.ResourceVersion = ""
+	crashingPod.Name = "api-crashing"
+	crashingPod.Status.ContainerStatuses = []v1.ContainerStatus{
+		{Name: "app", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+	}
+	assert.NoError(reconciler.Client.Create(ctx, crashingPod))
+
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	workload := getWorkload()
+	assert.False(isWorkloadPatched(workload))
+	assert.Equal(original.Spec.Template, *workload.PodTemplate)
+	reason, ok := getQuarantineReason(workload)
+	assert.True(ok)
+	assert.Equal("container app of pod api-crashing is in CrashLoopBackOff", reason)
+
+	// Not patched again while quarantined
+	assert.NoError(reconciler.Client.Delete(ctx, crashingPod))
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.False(isWorkloadPatched(getWorkload()))
+
+	status := buildStatus(configuration, rookout.RookoutStatus{}, reconciler.DeploymentsManager.ListSyncResults())
+	assert.Equal(0, status.PatchedCount)
+	assert.Equal(0, status.FailedCount)
+	assert.Equal(1, status.QuarantinedCount)
+	assert.Len(status.QuarantinedWorkloads, 1)
+	assert.Equal(reason, status.QuarantinedWorkloads[0].Message)
+
+	// Released once the annotation is removed
+	released := getWorkload()
+	annotations := released.GetAnnotations()
+	delete(annotations, QuarantineAnnotation)
+	released.SetAnnotations(annotations)
+	assert.NoError(reconciler.Client.Update(ctx, released.Object))
+
+	assert.NoError(reconciler.syncWorkload(ctx, getWorkload()))
+	assert.True(isWorkloadPatched(getWorkload()))
+}
+
+func TestQuarantineStaleRolloutCondition(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	useTestConfigurations(t)
+
+	configuration := newOperatorConfiguration(newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{}))
+	configurations.Update(configuration)
+
+	// The deadline was exceeded by the rollout before our patch, which the deployment controller didn't observe yet
+	deployment := newTestDeployment("default", "api")
+	deployment.Generation = 2
+	deployment.Status.ObservedGeneration = 1
+	deployment.Status.Conditions = []apps.DeploymentCondition{{Type: apps.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: "deadline exceeded"}}
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+	injectAgent(configuration, workload)
+
+	done, failure := workloadRolloutStatus(workload, true)
+	assert.False(done)
+	assert.Empty(failure)
+
+	reconciler := newTestReconciler(t, deployment)
+	assert.NoError(reconciler.syncWorkload(ctx, getTestWorkload(t, reconciler, "default", "api")))
+	workload = getTestWorkload(t, reconciler, "default", "api")
+	assert.True(isWorkloadPatched(workload))
+	_, ok := getQuarantineReason(workload)
+	assert.False(ok)
+
+	// Observed, the condition is about our patch
+	current := workload.Object.(*apps.Deployment)
+	current.Status.ObservedGeneration = current.Generation
+	assert.NoError(reconciler.Client.Status().Update(ctx, current))
+
+	assert.NoError(reconciler.syncWorkload(ctx, getTestWorkload(t, reconciler, "default", "api")))
+	workload = getTestWorkload(t, reconciler, "default", "api")
+	assert.False(isWorkloadPatched(workload))
+	reason, ok := getQuarantineReason(workload)
+	assert.True(ok)
+	assert.Equal("rollout failed: deadline exceeded", reason)
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Returned when the rollout policy doesn't let us patch the workload yet, the workload is synced again later
+type rolloutPendingError struct {
+	reason       string
+	requeueAfter time.Duration
+}
+
+func (e *rolloutPendingError) Error() string {
+	return e.reason
+}
+
+type trackedRollout struct {
+	kind           rookoutv1alpha1.WorkloadKind
+	namespacedName types.NamespacedName
+	// The workload's generation once we patched it, the cache might not have caught up yet
+	generation int64
+}
+
+// Workloads patched under a rollout policy, per configuration, until their rollout is seen complete
+type rolloutTracker struct {
+	// Held while deciding whether a workload can be patched and patching it
+	lock     sync.Mutex
+	rollouts map[string]map[string]*trackedRollout
+}
+
+func newRolloutTracker() *rolloutTracker {
+	return &rolloutTracker{rollouts: map[string]map[string]*trackedRollout{}}
+}
+
+// Whether the workload's controller is done rolling out its last change and why it failed to, if it did. DaemonSets
+// and StatefulSets with the OnDelete strategy (which only update pods when they are deleted) and CronJobs don't roll out
+func workloadRolloutStatus(workload *Workload, waitForAvailable bool) (bool, string) {
+	switch typed := workload.Object.(type) {
+	case *apps.Deployment:
+		// Conditions are stale (e.g. the deadline exceeded by the previous rollout) until the patch is observed
+		if typed.Status.ObservedGeneration < typed.Generation {
+			return false, ""
+		}
+
+		for _, condition := range typed.Status.Conditions {
+			if condition.Type == apps.DeploymentProgressing && condition.Status == core.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+				return false, condition.Message
+			}
+		}
+
+		replicas := int32(1)
+		if typed.Spec.Replicas != nil {
+			replicas = *typed.Spec.Replicas
+		}
+		return !waitForAvailable || (typed.Status.UpdatedReplicas == replicas && typed.Status.Replicas == replicas && typed.Status.AvailableReplicas == replicas), ""
+	case *apps.StatefulSet:
+		if typed.Status.ObservedGeneration < typed.Generation {
+			return false, ""
+		}
+
+		replicas := int32(1)
+		if typed.Spec.Replicas != nil {
+			replicas = *typed.Spec.Replicas
+		}
+		return !waitForAvailable || typed.Spec.UpdateStrategy.Type == apps.OnDeleteStatefulSetStrategyType ||
+			(typed.Status.UpdatedReplicas == replicas && typed.Status.ReadyReplicas == replicas && typed.Status.CurrentRevision == typed.Status.UpdateRevision), ""
+	case *apps.DaemonSet:
+		if typed.Status.ObservedGeneration < typed.Generation {
+			return false, ""
+		}
+
+		return !waitForAvailable || typed.Spec.UpdateStrategy.Type == apps.OnDeleteDaemonSetStrategyType ||
+			(typed.Status.UpdatedNumberScheduled == typed.Status.DesiredNumberScheduled && typed.Status.NumberAvailable == typed.Status.DesiredNumberScheduled), ""
+	}
+
+	return true, ""
+}
+
+// Patches the workload when the configuration's rollout policy allows it, returns a rolloutPendingError (and leaves
+// the workload untouched) otherwise
+func (r *RookoutReconciler) sendRolloutPatch(ctx context.Context, workload *Workload, originalWorkload client.Object, configuration *OperatorConfiguration) (string, error) {
+	if configuration == nil || configuration.Spec.RolloutPolicy == nil || configuration.isDryRun() || workload.Kind == rookoutv1alpha1.CronJobKind {
+		return r.sendPatch(ctx, workload, originalWorkload, configuration)
+	}
+
+	r.rollouts.lock.Lock()
+	defer r.rollouts.lock.Unlock()
+
+	reason, err := r.checkRollouts(ctx, configuration, workload)
+	if err != nil {
+		return "", err
+	}
+
+	if reason != "" {
+		logrus.Infof("Not patching %s yet, %s", workload, reason)
+		restoreWorkload(workload, originalWorkload)
+		return "", &rolloutPendingError{reason: reason, requeueAfter: configuration.Spec.RequeueAfter}
+	}
+
+	dryRunPatch, err := r.sendPatch(ctx, workload, originalWorkload, configuration)
+	if err != nil {
+		return "", err
+	}
+
+	tracked, ok := r.rollouts.rollouts[configuration.key()]
+	if !ok {
+		tracked = map[string]*trackedRollout{}
+		r.rollouts.rollouts[configuration.key()] = tracked
+	}
+	tracked[createDeploymentKey(string(workload.Kind), workload.NamespacedName())] = &trackedRollout{
+		kind:           workload.Kind,
+		namespacedName: workload.NamespacedName(),
+		generation:     workload.GetGeneration(),
+	}
+
+	return dryRunPatch, nil
+}
+
+// Returns why the workload can't be patched yet, if it can't. Rollouts are those of the workloads patched with the
+// configuration (read from the cache) and of the workloads we just patched, which the cache might not show yet
+func (r *RookoutReconciler) checkRollouts(ctx context.Context, configuration *OperatorConfiguration, workload *Workload) (string, error) {
+	policy := configuration.Spec.RolloutPolicy
+	workloadKey := createDeploymentKey(string(workload.Kind), workload.NamespacedName())
+	tracked := r.rollouts.rollouts[configuration.key()]
+	workloads := map[string]*Workload{}
+
+	patched, err := r.listConfigurationWorkloads(ctx, types.NamespacedName{Namespace: configuration.Namespace, Name: configuration.Name})
+	if err != nil {
+		return "", err
+	}
+	for _, patchedWorkload := range patched {
+		workloads[createDeploymentKey(string(patchedWorkload.Kind), patchedWorkload.NamespacedName())] = patchedWorkload
+	}
+
+	for key, rollout := range tracked {
+		if _, ok := workloads[key]; ok {
+			continue
+		}
+
+		obj, err := newWorkloadObject(rollout.kind)
+		if err != nil {
+			return "", err
+		}
+
+		err = r.Client.Get(ctx, rollout.namespacedName, obj)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				delete(tracked, key)
+				continue
+			}
+			return "", err
+		}
+
+		workloads[key], err = newWorkload(obj)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	inProgress := 0
+	var failed []string
+	for key, patchedWorkload := range workloads {
+		// Being patched again
+		if key == workloadKey {
+			continue
+		}
+
+		// Reported with the quarantined workloads below
+		if _, quarantined := getQuarantineReason(patchedWorkload); quarantined {
+			delete(tracked, key)
+			continue
+		}
+
+		if rollout, ok := tracked[key]; ok && patchedWorkload.GetGeneration() < rollout.generation {
+			inProgress++
+			continue
+		}
+
+		done, failure := workloadRolloutStatus(patchedWorkload, policy.WaitForAvailable)
+		if failure != "" {
+			failed = append(failed, fmt.Sprintf("%s (%s)", patchedWorkload, failure))
+			continue
+		}
+
+		if done {
+			delete(tracked, key)
+			continue
+		}
+		inProgress++
+	}
+
+	// Quarantining removed the agent, so these workloads aren't listed anymore, their rollout still failed
+	for key, result := range r.DeploymentsManager.ListSyncResults() {
+		if result.isQuarantined && result.configuration == configuration.key() && key != workloadKey {
+			failed = append(failed, fmt.Sprintf("%s %s/%s (quarantined, %s)", result.Kind, result.Namespace, result.Name, result.Message))
+		}
+	}
+
+	if policy.PauseOnFailure && len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Sprintf("rollout paused, rollout failed for %s", strings.Join(failed, ", ")), nil
+	}
+
+	if policy.MaxConcurrent > 0 && inProgress >= int(policy.MaxConcurrent) {
+		return fmt.Sprintf("waiting for %d workloads to complete their rollout", inProgress), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRolloutPolicy(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Spec.RolloutPolicy = &rookout.RolloutPolicy{MaxConcurrent: 1, WaitForAvailable: true, PauseOnFailure: true}
+	configurations.Update(newOperatorConfiguration(config))
+
+	reconciler := newTestReconciler(t)
+
+	// The fake client ignores field selectors, workloads are created when synced so only patched ones are listed
+	sync := func(name string) (*apps.Deployment, error) {
+		deployment := &apps.Deployment{}
+		err := reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, deployment)
+		if apierrors.IsNotFound(err) {
+			deployment = newTestDeployment("default", name)
+			err = reconciler.Client.Create(ctx, deployment)
+		}
+		assert.NoError(err)
+
+		workload, err := newWorkload(deployment)
+		assert.NoError(err)
+		return deployment, reconciler.syncWorkload(ctx, workload)
+	}
+
+	api, err := sync("api")
+	assert.NoError(err)
+	assert.Contains(api.Annotations, PatchStateAnnotation)
+
+	// api is still rolling out
+	web, err := sync("web")
+	var pending *rolloutPendingError
+	assert.True(errors.As(err, &pending))
+	assert.Equal("waiting for 1 workloads to complete their rollout", pending.reason)
+	assert.NotContains(web.Annotations, PatchStateAnnotation)
+	current := &apps.Deployment{}
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "web"}, current))
+	assert.NotContains(current.Annotations, PatchStateAnnotation)
+
+	api.Status = apps.DeploymentStatus{ObservedGeneration: api.Generation, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+	assert.NoError(reconciler.Client.Status().Update(ctx, api))
+	_, err = sync("web")
+	assert.NoError(err)
+
+	// web's rollout failed, the rollout is paused
+	web.Status.Conditions = []apps.DeploymentCondition{{Type: apps.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: "deadline exceeded"}}
+	assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "web"}, current))
+	current.Status = web.Status
+	assert.NoError(reconciler.Client.Status().Update(ctx, current))
+	_, err = sync("worker")
+	assert.True(errors.As(err, &pending))
+	assert.Equal("rollout paused, rollout failed for Deployment default/web (deadline exceeded)", pending.reason)
+
+	status := buildStatus(configurations.List()[0], rookout.RookoutStatus{}, reconciler.DeploymentsManager.ListSyncResults())
+	assert.Equal(0, status.FailedCount)
+	assert.Len(status.PendingWorkloads, 1)
+	assert.Equal("worker", status.PendingWorkloads[0].Name)
+}
+
+func TestRolloutPolicyQuarantine(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	config.Spec.RolloutPolicy = &rookout.RolloutPolicy{PauseOnFailure: true}
+	configurations.Update(newOperatorConfiguration(config))
+
+	reconciler := newTestReconciler(t, newTestDeployment("default", "api"), newTestDeployment("default", "web"))
+	assert.NoError(reconciler.syncWorkload(ctx, getTestWorkload(t, reconciler, "default", "api")))
+
+	// api's rollout failed, it is quarantined and doesn't have the agent (nor the configuration annotation) anymore
+	api := getTestWorkload(t, reconciler, "default", "api").Object.(*apps.Deployment)
+	api.Status.ObservedGeneration = api.Generation
+	api.Status.Conditions = []apps.DeploymentCondition{{Type: apps.DeploymentProgressing, Status: v1.ConditionFalse, Reason: "ProgressDeadlineExceeded", Message: "deadline exceeded"}}
+	assert.NoError(reconciler.Client.Status().Update(ctx, api))
+	assert.NoError(reconciler.syncWorkload(ctx, getTestWorkload(t, reconciler, "default", "api")))
+	quarantined := getTestWorkload(t, reconciler, "default", "api")
+	assert.False(isWorkloadPatched(quarantined))
+	assert.NotContains(quarantined.PodTemplate.Annotations, ConfigurationAnnotation)
+
+	// The rollout stays paused
+	err := reconciler.syncWorkload(ctx, getTestWorkload(t, reconciler, "default", "web"))
+	var pending *rolloutPendingError
+	assert.True(errors.As(err, &pending))
+	assert.Equal("rollout paused, rollout failed for Deployment default/api (quarantined, rollout failed: deadline exceeded)", pending.reason)
+	assert.False(isWorkloadPatched(getTestWorkload(t, reconciler, "default", "web")))
+}
@@ -2,33 +2,42 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"errors"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
-	"sigs.k8s.io/controller-runtime/pkg/handler"
-	"sigs.k8s.io/controller-runtime/pkg/source"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
 )
 
 const (
 	DefaultRequeueAfter                 = 10 * time.Second
+	WorkloadEventsBufferSize            = 1024
 	DefaultInitContainerName            = "agent-init-container"
 	DefaultInitContainerImagePullPolicy = core.PullAlways
 	DefaultSharedVolumeName             = "rookout-agent-shared-volume"
 	DefaultSharedVolumeMountPath        = "/rookout"
-	RookoutEnvVarPreffix                = "ROOKOUT_"
-	RookoutTokenEnvVar                  = "ROOKOUT_TOKEN"
-	RookoutControllerHostEnvVar         = "ROOKOUT_CONTROLLER_HOST"
+	RookoutEnvVarPreffix                = rookoutv1alpha1.RookoutEnvVarPrefix
+	RookoutTokenEnvVar                  = rookoutv1alpha1.RookoutTokenEnvVar
+	RookoutControllerHostEnvVar         = rookoutv1alpha1.RookoutControllerHostEnvVar
 )
 
 type RookoutReconciler struct {
@@ -36,15 +45,42 @@ type RookoutReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
-	DeploymentsManager DeploymentsManager
+	DeploymentsManager *DeploymentsManager
+	// The namespaces the operator is restricted to (the manager's cache only holds them), all namespaces when empty
+	Namespaces []string
+	// The namespaces whose configurations may use the Cluster scope, anyone able to create a configuration there can
+	// instrument every namespace
+	ClusterScopeNamespaces []string
+	// Every configuration is in dry run mode, workloads are never patched
+	DryRun bool
+	// Of every controller (configurations and each workload kind), 1 when not set
+	MaxConcurrentReconciles int
+	// Records events on workloads and configurations, none are recorded when not set
+	Recorder record.EventRecorder
+	// Reads the objects we don't want to cache (pods, secrets), the client is used when not set
+	APIReader client.Reader
+	// Workloads enqueued by configuration changes, one channel per workload kind
+	workloadEvents map[rookoutv1alpha1.WorkloadKind]chan event.GenericEvent
+	// Configurations enqueued when their token secrets change
+	configurationEvents chan event.GenericEvent
+	// Signals runStatusUpdates that workloads were synced, the status is updated right away when not set
+	statusUpdates chan struct{}
+	rollouts      *rolloutTracker
 }
 
-type OperatorConfiguration struct {
-	rookoutv1alpha1.Rookout
-	isReady bool
+func (r *RookoutReconciler) uncachedReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+
+	return r.Client
 }
 
-var configuration = OperatorConfiguration{isReady: false}
+// Reconciles workloads of a single kind, so we know the kind of every request
+type workloadReconciler struct {
+	*RookoutReconciler
+	kind rookoutv1alpha1.WorkloadKind
+}
 
 // !!!!!!!!!!!!!!!!!!!!
 // Operator permissions - make sure we don't have unused permissions here
@@ -53,286 +89,318 @@ var configuration = OperatorConfiguration{isReady: false}
 // +kubebuilder:rbac:groups=rookout.rookout.com,resources=rookouts/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=rookout.rookout.com,resources=rookouts/finalizers,verbs=update
 // +kubebuilder:rbac:groups="apps",resources=deployments,verbs=get;watch;list;patch
+// +kubebuilder:rbac:groups="apps",resources=statefulsets,verbs=get;watch;list;patch
+// +kubebuilder:rbac:groups="apps",resources=daemonsets,verbs=get;watch;list;patch
+// +kubebuilder:rbac:groups="batch",resources=cronjobs,verbs=get;watch;list;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;watch;list
 
 func (r *RookoutReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var configuration *OperatorConfiguration
+	operatorConfiguration := rookoutv1alpha1.Rookout{}
+	err := r.Client.Get(ctx, req.NamespacedName, &operatorConfiguration)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
 
-	switch getResourceType(req) {
-	case OperatorConfigurationResource:
-		{
-			operatorConfiguration := rookoutv1alpha1.Rookout{}
-			err := r.Client.Get(ctx, req.NamespacedName, &operatorConfiguration)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
-
-			r.updateOperatorConfiguration(operatorConfiguration)
-			r.syncDeployments(ctx)
+		logrus.Infof("Operator configuration %s deleted", req.NamespacedName)
+		configurations.Remove(req.NamespacedName)
+	} else if !operatorConfiguration.DeletionTimestamp.IsZero() {
+		return r.finalizeConfiguration(ctx, &operatorConfiguration)
+	} else {
+		err = r.addCleanupFinalizer(ctx, &operatorConfiguration)
+		if err != nil {
+			return ctrl.Result{}, err
 		}
 
-	case DeploymentResource:
-		{
-			if !configuration.isReady {
-				return ctrl.Result{Requeue: true, RequeueAfter: configuration.Spec.RequeueAfter}, nil
-			}
+		// Tenants of a restricted operator can only instrument their own namespace
+		if len(r.Namespaces) > 0 {
+			operatorConfiguration.Spec.Scope = rookoutv1alpha1.NamespaceScope
+		}
 
-			deployment := apps.Deployment{}
-			err := r.Client.Get(ctx, req.NamespacedName, &deployment)
-			if err != nil {
-				if !strings.Contains(err.Error(), "not found") {
-					r.DeploymentsManager.ForgetDeployment(req.NamespacedName)
-					logrus.Errorf("Deployment not found, maybe already deleted. deployment: %s", req.NamespacedName)
-				}
-				return ctrl.Result{}, nil
-			}
+		if r.DryRun {
+			operatorConfiguration.Spec.Mode = rookoutv1alpha1.DryRunOperatorMode
+		}
 
-			err = r.syncDeployment(ctx, &deployment)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
+		configuration = newOperatorConfiguration(operatorConfiguration)
+		// Namespaces are cluster scoped, a restricted operator can't read their labels
+		if len(r.Namespaces) > 0 && configuration.isReady && configuration.usesNamespaceSelector() {
+			configuration.isReady = false
+			configuration.readyReason = "NamespaceSelectorNotSupported"
+			configuration.readyMessage = "Namespace selectors can't be used when the operator is restricted to a set of namespaces"
 		}
-	}
 
-	return ctrl.Result{}, nil
-}
+		if configuration.isReady && configuration.Spec.Scope == rookoutv1alpha1.ClusterScope && !containsString(r.ClusterScopeNamespaces, configuration.Namespace) {
+			configuration.isReady = false
+			configuration.readyReason = "ClusterScopeNotAllowed"
+			configuration.readyMessage = "Cluster scope isn't allowed in this namespace, the operator only allows it in namespaces listed by --cluster-scope-namespaces"
+		}
 
-func (r *RookoutReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		Watches(&source.Kind{Type: &apps.Deployment{}}, &handler.EnqueueRequestForObject{}).
-		For(&rookoutv1alpha1.Rookout{}).
-		Complete(r)
-}
+		err = r.resolveTokenSecrets(ctx, configuration)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 
-func (r *RookoutReconciler) updateOperatorConfiguration(config rookoutv1alpha1.Rookout) {
-	configuration.isReady = false
-	configuration.Spec.Matchers = config.Spec.Matchers
-	configuration.Spec.InitContainer.Image = getConfigStr(config.Spec.InitContainer.Image, DefaultInitContainerImage)
-	configuration.Spec.InitContainer.ImagePullPolicy = core.PullPolicy(getConfigStr(string(config.Spec.InitContainer.ImagePullPolicy), string(DefaultInitContainerImagePullPolicy)))
-	configuration.Spec.InitContainer.ContainerName = getConfigStr(config.Spec.InitContainer.ContainerName, DefaultInitContainerName)
-	configuration.Spec.InitContainer.SharedVolumeMountPath = getConfigStr(config.Spec.InitContainer.SharedVolumeMountPath, DefaultSharedVolumeMountPath)
-	configuration.Spec.InitContainer.SharedVolumeName = getConfigStr(config.Spec.InitContainer.SharedVolumeMountPath, DefaultSharedVolumeName)
-
-	if config.Spec.RequeueAfter > 0 {
-		configuration.Spec.RequeueAfter = config.Spec.RequeueAfter
-	} else {
-		configuration.Spec.RequeueAfter = DefaultRequeueAfter
+		configurations.Update(configuration)
 	}
 
-	if len(configuration.Spec.Matchers) == 0 {
-		logrus.Error("No matchers found in configuration")
-		return
+	// Any workload might be matched by another configuration now
+	err = r.enqueueConfigurationWorkloads(ctx, req.NamespacedName, configuration)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
-	for _, matcher := range configuration.Spec.Matchers {
-		rookoutTokenFound := false
-		onPremControllerFound := false
-
-		for _, envVar := range matcher.EnvVars {
-			if envVar.Name == RookoutTokenEnvVar {
-				rookoutTokenFound = true
-			}
+	err = r.updateStatus(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-			if envVar.Name == RookoutControllerHostEnvVar {
-				onPremControllerFound = true
-			}
+	return ctrl.Result{}, nil
+}
 
-			if onPremControllerFound && rookoutTokenFound {
-				break
-			}
-		}
+func (r *workloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	obj, err := newWorkloadObject(r.kind)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-		if !rookoutTokenFound && !onPremControllerFound {
-			logrus.Infof("Are you trying to connect to a deployed Rookout controller? if so, use %s and if you don't, use %s. See our docs at docs.rookout.com\"t", RookoutControllerHostEnvVar, RookoutTokenEnvVar)
-			return
+	err = r.Client.Get(ctx, req.NamespacedName, obj)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			r.DeploymentsManager.ForgetDeployment(string(r.kind), req.NamespacedName)
+			return ctrl.Result{}, r.requestStatusUpdate(ctx)
 		}
+		return ctrl.Result{}, err
 	}
 
-	configuration.isReady = true
-	logrus.Info("Operator configuration updated")
-}
-
-func (r *RookoutReconciler) syncDeployment(ctx context.Context, deployment *apps.Deployment) error {
-	matchFound := false
+	workload, err := newWorkload(obj)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-	originalDeployment := client.MergeFrom(deployment.DeepCopy())
+	// Configurations might not be loaded yet (operator startup), we don't want to unpatch workloads meanwhile. Unless
+	// the configuration which patched the workload was deleted and is waiting for the agent to be removed
+	if !configurations.IsAnyReady() && !configurations.IsFinalizing(workload.PodTemplate.Annotations[ConfigurationAnnotation]) {
+		return ctrl.Result{Requeue: true, RequeueAfter: DefaultRequeueAfter}, nil
+	}
 
-	var updatedContainers []core.Container
-	for _, container := range deployment.Spec.Template.Spec.Containers {
+	err = setNamespaceLabels(ctx, r.Client, workload)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-		logrus.Infof("Validating container %s of deployment %s in %s namespace", container.Name, deployment.Name, deployment.GetNamespace())
-		containerMatched := false
-		for _, matcher := range configuration.Spec.Matchers {
-			if deploymentMatch(matcher, *deployment) && containerMatch(matcher, container) && namespaceMatch(matcher, *deployment) && labelsMatch(matcher, *deployment) {
-				setRookoutEnvVars(&container.Env, matcher.EnvVars)
-				containerMatched = true
-				break
-			}
+	result := ctrl.Result{}
+	err = r.syncWorkload(ctx, workload)
+	if err != nil {
+		var pending *rolloutPendingError
+		if !errors.As(err, &pending) {
+			return ctrl.Result{}, err
 		}
+		result.RequeueAfter = pending.requeueAfter
+	} else if done, _ := workloadRolloutStatus(workload, true); isWorkloadPatched(workload) && !done {
+		// Crash looping pods don't always update the workload's status, checking its health until it's rolled out
+		result.RequeueAfter = DefaultRequeueAfter
+	}
 
-		if !containerMatched {
-			continue
-		}
+	err = r.requestStatusUpdate(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
-		container.Env = r.addJavaAgentEnvVar(container)
+	return result, nil
+}
 
-		container.VolumeMounts = append(container.VolumeMounts, core.VolumeMount{
-			Name:      configuration.Spec.InitContainer.SharedVolumeName,
-			MountPath: configuration.Spec.InitContainer.SharedVolumeMountPath,
-		})
+// Maps a namespace to the configurations using namespace selectors, which resync every workload
+func (r *RookoutReconciler) namespaceSelectorConfigurations(obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
 
-		updatedContainers = append(updatedContainers, container)
-		matchFound = true
+	for _, configuration := range configurations.List() {
+		if configuration.usesNamespaceSelector() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: configuration.Namespace, Name: configuration.Name}})
+		}
 	}
 
-	if !matchFound {
-		var err error = nil
+	return requests
+}
 
-		if r.DeploymentsManager.IsDeploymentMarkedAsPatched(*deployment) || doesDeploymentHaveJavaSDKContainer(deployment) {
-			err = r.unpatchDeployment(ctx, deployment, originalDeployment)
+var namespaceLabelsChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return !equality.Semantic.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+}
 
-			if err != nil {
-				logrus.Infof("Successfully removed java SDK from %s", deployment.Namespace+"/"+deployment.Name)
-			}
-		}
+func (r *RookoutReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	options := controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}
+	r.workloadEvents = map[rookoutv1alpha1.WorkloadKind]chan event.GenericEvent{}
+	r.configurationEvents = make(chan event.GenericEvent, WorkloadEventsBufferSize)
+	r.rollouts = newRolloutTracker()
 
-		r.DeploymentsManager.MarkDeploymentAsPatched(*deployment)
-		return err
-	}
+	r.statusUpdates = make(chan struct{}, 1)
 
-	// Edge case - on first run, deployments might be patched but not registered in r.DeploymentsManager
-	if doesDeploymentHaveJavaSDKContainer(deployment) {
-		r.DeploymentsManager.MarkDeploymentAsNotPatched(*deployment)
-		return nil
+	err := mgr.Add(manager.RunnableFunc(r.pollTokenSecrets))
+	if err != nil {
+		return err
 	}
 
-	// Patching Deployment
-	logrus.Infof("Adding rookout agent to deployment %s in %s namespace", deployment.Name, deployment.GetNamespace())
-	deployment.Spec.Template.Spec.Containers = updatedContainers
-
-	deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, core.Volume{
-		Name:         configuration.Spec.InitContainer.SharedVolumeName,
-		VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}},
-	})
-
-	deployment.Spec.Template.Spec.InitContainers = append(deployment.Spec.Template.Spec.InitContainers, core.Container{
-		Image:           configuration.Spec.InitContainer.Image,
-		ImagePullPolicy: configuration.Spec.InitContainer.ImagePullPolicy,
-		Name:            configuration.Spec.InitContainer.ContainerName,
-		VolumeMounts: []core.VolumeMount{
-			{
-				Name:      configuration.Spec.InitContainer.SharedVolumeName,
-				MountPath: configuration.Spec.InitContainer.SharedVolumeMountPath},
-		},
-	})
-
-	err := r.Client.Patch(ctx, deployment, originalDeployment)
+	err = mgr.Add(manager.RunnableFunc(r.runStatusUpdates))
 	if err != nil {
 		return err
 	}
 
-	r.DeploymentsManager.MarkDeploymentAsNotPatched(*deployment)
-	logrus.Infof("Deployment %s patched successfully", deployment.Name)
-	return nil
-}
+	for _, kind := range supportedWorkloadKinds {
+		obj, err := newWorkloadObject(kind)
+		if err != nil {
+			return err
+		}
 
-func doesDeploymentHaveJavaSDKContainer(deployment *apps.Deployment) bool {
-	for _, initContainer := range deployment.Spec.Template.Spec.InitContainers {
-		if initContainer.Name == configuration.Spec.InitContainer.ContainerName {
-			return true
+		err = mgr.GetFieldIndexer().IndexField(context.Background(), obj, ConfigurationIndexField, workloadConfigurationIndex)
+		if err != nil {
+			return err
+		}
+
+		r.workloadEvents[kind] = make(chan event.GenericEvent, WorkloadEventsBufferSize)
+		err = ctrl.NewControllerManagedBy(mgr).
+			For(obj).
+			Watches(&source.Channel{Source: r.workloadEvents[kind]}, &handler.EnqueueRequestForObject{}).
+			WithOptions(options).
+			Complete(&workloadReconciler{RookoutReconciler: r, kind: kind})
+		if err != nil {
+			return err
 		}
 	}
 
-	return false
-}
+	configurationController := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(options).
+		// Ignoring our own status updates
+		For(&rookoutv1alpha1.Rookout{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, forceRemovalAnnotationChangedPredicate))).
+		Watches(&source.Channel{Source: r.configurationEvents}, &handler.EnqueueRequestForObject{})
+
+	// Namespace labels changes might change the workloads matched by namespace selectors
+	if len(r.Namespaces) == 0 {
+		configurationController = configurationController.Watches(
+			&source.Kind{Type: &core.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(r.namespaceSelectorConfigurations),
+			builder.WithPredicates(namespaceLabelsChangedPredicate),
+		)
+	}
 
-func (r *RookoutReconciler) addJavaAgentEnvVar(container core.Container) []core.EnvVar {
-	newEnvVars := container.Env
-	JavaAgent := fmt.Sprintf("-javaagent:%s/rook.jar", configuration.Spec.InitContainer.SharedVolumeMountPath)
+	return configurationController.Complete(r)
+}
 
-	javaToolOptionsEnvVarIndex := -1
+func (r *RookoutReconciler) syncWorkload(ctx context.Context, workload *Workload) error {
+	configuration := findWorkloadConfiguration(workload)
 
-	for index, envVar := range container.Env {
-		if envVar.Name == "JAVA_TOOL_OPTIONS" {
-			javaToolOptionsEnvVarIndex = index
-			break
+	var err error
+	if configuration != nil && !r.isDryRun(configuration) {
+		err = r.copyTokenSecrets(ctx, configuration, workload.GetNamespace())
+		if err != nil {
+			r.recordPatchFailure(workload, PatchFailedEventReason, err)
 		}
 	}
 
-	if javaToolOptionsEnvVarIndex == -1 {
-		newEnvVars = append(newEnvVars, core.EnvVar{
-			Name:  "JAVA_TOOL_OPTIONS",
-			Value: JavaAgent,
-		})
-	} else {
-		newEnvVars[javaToolOptionsEnvVarIndex].Value = newEnvVars[javaToolOptionsEnvVarIndex].Value + " " + JavaAgent
+	var dryRunPatch string
+	if err == nil {
+		dryRunPatch, err = r.patchWorkload(ctx, workload, configuration)
 	}
 
-	return newEnvVars
+	r.DeploymentsManager.SetSyncResult(workload, configuration, err == nil && isWorkloadPatched(workload), dryRunPatch, err)
+	return err
 }
 
-func (r *RookoutReconciler) syncDeployments(ctx context.Context) {
-	for _, deployment := range r.DeploymentsManager.Deployments {
-		if !deployment.isPatched {
-			r.syncDeployment(ctx, deployment.Deployment)
+// Adds the agent to the workload or removes it, according to the configuration matching it (if any). In dry run mode
+// the workload is left untouched and the patch which would have been sent is returned
+func (r *RookoutReconciler) patchWorkload(ctx context.Context, workload *Workload, configuration *OperatorConfiguration) (string, error) {
+	originalWorkload := workload.Object.DeepCopyObject().(client.Object)
+
+	// Unhealthy once patched, we only make sure the agent was removed until the workload is released
+	_, quarantined := getQuarantineReason(workload)
+
+	// In pod injection mode the webhook instruments the pods, so we only clean up workloads we patched before
+	if configuration == nil || configuration.Spec.InjectionMode == rookoutv1alpha1.PodInjectionMode || quarantined {
+		if !isWorkloadPatched(workload) {
+			return "", nil
 		}
-	}
-}
 
-func (r *RookoutReconciler) unpatchDeployment(ctx context.Context, deployment *apps.Deployment, patchObj client.Patch) error {
-	var updatedContainers []core.Container
-	var updatedInitContainers []core.Container
-	var updatedVolumes []core.Volume
+		dryRunPatch, err := r.unpatchWorkload(ctx, workload, originalWorkload, configuration)
+		if err != nil {
+			r.recordPatchFailure(workload, UnpatchFailedEventReason, err)
+		} else if dryRunPatch == "" {
+			logrus.Infof("Successfully removed rookout agent from %s, %s", workload, workload.rolloutDescription())
+			r.recordEvent(workload.Object, core.EventTypeNormal, AgentRemovedEventReason, "Rookout agent removed")
+		}
 
-	// Cleaning Env vars & volumeMounts per container
-	for _, container := range deployment.Spec.Template.Spec.Containers {
-		var updatedEnvVars []core.EnvVar
-		var updatedVolumeMounts []core.VolumeMount
+		return dryRunPatch, err
+	}
 
-		for _, envVar := range container.Env {
-			if envVar.Name == "JAVA_TOOL_OPTIONS" {
-				javaToolOptions := strings.Split(envVar.Value, " ")
-				javaToolOptions = removeElementWithSuffix(javaToolOptions, "rook.jar")
+	// Already patched (maybe before the operator started), re-injecting the agent in case the configuration,
+	// the workload's annotations or the token secret changed since then
+	if isWorkloadPatched(workload) {
+		if !r.isDryRun(configuration) {
+			reason, err := r.checkWorkloadHealth(ctx, workload)
+			if err != nil {
+				return "", err
+			}
 
-				if len(javaToolOptions) == 0 {
-					continue
+			if reason != "" {
+				err = r.quarantineWorkload(ctx, workload, reason)
+				if err != nil {
+					r.recordPatchFailure(workload, UnpatchFailedEventReason, err)
+					return "", err
 				}
 
-				envVar.Value = strings.Join(javaToolOptions, " ")
+				r.recordEvent(workload.Object, core.EventTypeWarning, QuarantinedEventReason, "Rookout agent removed and workload quarantined, %s", reason)
+				return "", nil
 			}
+		}
 
-			if strings.HasPrefix(envVar.Name, RookoutEnvVarPreffix) {
-				continue
-			}
+		desiredWorkload := workload.DeepCopy()
+		removeAgent(desiredWorkload)
+		injectAgent(configuration, desiredWorkload)
 
-			updatedEnvVars = append(updatedEnvVars, envVar)
-		}
+		if !equality.Semantic.DeepEqual(desiredWorkload.PodTemplate, workload.PodTemplate) || !equality.Semantic.DeepEqual(desiredWorkload.GetAnnotations(), workload.GetAnnotations()) {
+			logrus.Infof("Updating rookout agent of %s using configuration %s", workload, configuration.key())
+			*workload.PodTemplate = *desiredWorkload.PodTemplate
+			workload.SetAnnotations(desiredWorkload.GetAnnotations())
 
-		for _, volumeMount := range container.VolumeMounts {
-			if volumeMount.Name != configuration.Spec.InitContainer.SharedVolumeName {
-				updatedVolumeMounts = append(updatedVolumeMounts, volumeMount)
+			dryRunPatch, err := r.sendRolloutPatch(ctx, workload, originalWorkload, configuration)
+			if err != nil {
+				r.recordPatchFailure(workload, PatchFailedEventReason, err)
 			}
+			if err != nil || dryRunPatch != "" {
+				return dryRunPatch, err
+			}
+
+			logrus.Infof("%s updated successfully, %s", workload, workload.rolloutDescription())
+			r.recordEvent(workload.Object, core.EventTypeNormal, AgentUpdatedEventReason, "Rookout agent updated by configuration %s, matchers %s",
+				configuration.key(), describeWorkloadMatchers(configuration, workload))
 		}
 
-		container.Env = updatedEnvVars
-		container.VolumeMounts = updatedVolumeMounts
-		updatedContainers = append(updatedContainers, container)
+		return "", nil
 	}
 
-	// Removing Rookout volume and init container
-	for _, volume := range deployment.Spec.Template.Spec.Volumes {
-		if volume.Name != configuration.Spec.InitContainer.SharedVolumeName {
-			updatedVolumes = append(updatedVolumes, volume)
-		}
-	}
+	// Patching workload
+	logrus.Infof("Adding rookout agent to %s using configuration %s", workload, configuration.key())
+	matchers := describeWorkloadMatchers(configuration, workload)
+	injectAgent(configuration, workload)
 
-	for _, container := range deployment.Spec.Template.Spec.InitContainers {
-		if container.Name != configuration.Spec.InitContainer.ContainerName {
-			updatedInitContainers = append(updatedInitContainers, container)
-		}
+	dryRunPatch, err := r.sendRolloutPatch(ctx, workload, originalWorkload, configuration)
+	if err != nil {
+		r.recordPatchFailure(workload, PatchFailedEventReason, err)
 	}
+	if err != nil || dryRunPatch != "" {
+		return dryRunPatch, err
+	}
+
+	logrus.Infof("%s patched successfully, %s", workload, workload.rolloutDescription())
+	r.recordEvent(workload.Object, core.EventTypeNormal, AgentInjectedEventReason, "Rookout agent injected by configuration %s, matchers %s", configuration.key(), matchers)
+	return "", nil
+}
 
-	deployment.Spec.Template.Spec.Containers = updatedContainers
-	deployment.Spec.Template.Spec.InitContainers = updatedInitContainers
-	deployment.Spec.Template.Spec.Volumes = updatedVolumes
+func (r *RookoutReconciler) unpatchWorkload(ctx context.Context, workload *Workload, originalWorkload client.Object, configuration *OperatorConfiguration) (string, error) {
+	removeAgent(workload)
 
-	return r.Client.Patch(ctx, deployment, patchObj)
+	return r.sendRolloutPatch(ctx, workload, originalWorkload, configuration)
 }
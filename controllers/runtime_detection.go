@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	// Set by users on the workload or its pod template to override runtime detection,
+	// either for all containers ("rookout.com/runtime") or per container ("rookout.com/runtime.<container name>")
+	RuntimeAnnotation = "rookout.com/runtime"
+	// Set by the operator on the pod template, lists the runtime injected into each container
+	InjectedRuntimesAnnotation = "rookout.com/runtimes"
+	SkippedRuntime             = "skipped"
+)
+
+type runtimeSignals struct {
+	commands []string
+	files    []string
+	envVars  []string
+	// Known image names, matching the whole image repository or its last path segments (so library/node and
+	// bitnami/node match node, but node-exporter doesn't)
+	images []string
+}
+
+// Signals are matched against the container's command/args basenames, file extensions of its args,
+// its env var names and its image repository
+var runtimeDetectionSignals = map[rookoutv1alpha1.Runtime]runtimeSignals{
+	rookoutv1alpha1.JavaRuntime: {
+		commands: []string{"java", "catalina.sh", "mvn", "gradle"},
+		files:    []string{".jar", ".war"},
+		envVars:  []string{"JAVA_HOME", "JAVA_VERSION", "JAVA_TOOL_OPTIONS", "JAVA_OPTS", "CATALINA_HOME"},
+		images: []string{"openjdk", "eclipse-temurin", "amazoncorretto", "adoptopenjdk", "ibmjava", "ibm-semeru-runtimes",
+			"sapmachine", "tomcat", "jetty", "maven", "gradle", "jboss/wildfly", "distroless/java"},
+	},
+	rookoutv1alpha1.PythonRuntime: {
+		commands: []string{"python", "gunicorn", "uwsgi", "celery", "uvicorn", "flask"},
+		files:    []string{".py"},
+		envVars:  []string{"PYTHONPATH", "PYTHON_VERSION", "PYTHONUNBUFFERED", "VIRTUAL_ENV"},
+		images:   []string{"python", "pypy", "distroless/python3"},
+	},
+	rookoutv1alpha1.NodeRuntime: {
+		commands: []string{"node", "nodejs", "npm", "yarn", "pm2", "pm2-runtime"},
+		files:    []string{".js", ".mjs"},
+		envVars:  []string{"NODE_VERSION", "NODE_OPTIONS", "NODE_ENV", "YARN_VERSION"},
+		images:   []string{"node", "distroless/nodejs"},
+	},
+	rookoutv1alpha1.DotNetRuntime: {
+		commands: []string{"dotnet"},
+		files:    []string{".dll"},
+		envVars:  []string{"DOTNET_VERSION", "ASPNETCORE_URLS", "ASPNETCORE_VERSION", "DOTNET_RUNNING_IN_CONTAINER"},
+		images: []string{"dotnet/aspnet", "dotnet/runtime", "dotnet/sdk", "dotnet/core/aspnet", "dotnet/core/runtime",
+			"dotnet/core/sdk"},
+	},
+}
+
+// Returns the runtime to inject into the container and why it was chosen, an empty runtime means the container
+// should be skipped. Annotations take precedence over the command, env vars and image name (in this order)
+func resolveContainerRuntime(workload *Workload, container core.Container, matcher *rookoutv1alpha1.Matcher) (rookoutv1alpha1.Runtime, string) {
+	if matcher.Runtime != rookoutv1alpha1.AutoRuntime {
+		return getConfiguredRuntime(matcher.Runtime), "configured by matcher"
+	}
+
+	for _, annotations := range []map[string]string{workload.PodTemplate.Annotations, workload.GetAnnotations()} {
+		for _, key := range []string{RuntimeAnnotation + "." + container.Name, RuntimeAnnotation} {
+			if value, ok := annotations[key]; ok {
+				return parseRuntimeAnnotation(value), fmt.Sprintf("%s annotation", key)
+			}
+		}
+	}
+
+	commandLine := append(append([]string{}, container.Command...), container.Args...)
+	for _, runtime := range detectableRuntimes() {
+		signals := runtimeDetectionSignals[runtime]
+
+		for _, arg := range commandLine {
+			for _, word := range strings.Fields(arg) {
+				// Ignoring versions in binary names (python3.9)
+				command := strings.TrimRight(path.Base(word), "0123456789.")
+				if containsString(signals.commands, command) || hasAnySuffix(word, signals.files) {
+					return runtime, fmt.Sprintf("command %q", word)
+				}
+			}
+		}
+	}
+
+	for _, runtime := range detectableRuntimes() {
+		for _, envVar := range container.Env {
+			if containsString(runtimeDetectionSignals[runtime].envVars, envVar.Name) {
+				return runtime, fmt.Sprintf("env var %s", envVar.Name)
+			}
+		}
+	}
+
+	repository := imageRepository(container.Image)
+	for _, runtime := range detectableRuntimes() {
+		for _, image := range runtimeDetectionSignals[runtime].images {
+			if repository == image || strings.HasSuffix(repository, "/"+image) {
+				return runtime, fmt.Sprintf("image %s", container.Image)
+			}
+		}
+	}
+
+	return "", "no runtime detected"
+}
+
+// Stable order, so a container with signals of several runtimes always gets the same one
+func detectableRuntimes() []rookoutv1alpha1.Runtime {
+	return []rookoutv1alpha1.Runtime{
+		rookoutv1alpha1.JavaRuntime,
+		rookoutv1alpha1.DotNetRuntime,
+		rookoutv1alpha1.NodeRuntime,
+		rookoutv1alpha1.PythonRuntime,
+	}
+}
+
+func getConfiguredRuntime(runtime rookoutv1alpha1.Runtime) rookoutv1alpha1.Runtime {
+	if runtime == "" {
+		return rookoutv1alpha1.JavaRuntime
+	}
+
+	return runtime
+}
+
+// Annotation values are case insensitive, any unknown value (like "none") skips the container
+func parseRuntimeAnnotation(value string) rookoutv1alpha1.Runtime {
+	for runtime := range runtimeInjectors {
+		if strings.EqualFold(string(runtime), strings.TrimSpace(value)) {
+			return runtime
+		}
+	}
+
+	return ""
+}
+
+// Strips the tag and digest of an image reference, keeping its registry and path
+func imageRepository(image string) string {
+	if index := strings.Index(image, "@"); index != -1 {
+		image = image[:index]
+	}
+
+	if index := strings.LastIndex(image, ":"); index != -1 && !strings.Contains(image[index:], "/") {
+		image = image[:index]
+	}
+
+	return image
+}
+
+// "latest" when the image has neither a tag nor a digest, empty when it only has a digest
+func imageTag(image string) string {
+	hasDigest := false
+	if index := strings.Index(image, "@"); index != -1 {
+		image = image[:index]
+		hasDigest = true
+	}
+
+	if index := strings.LastIndex(image, ":"); index != -1 && !strings.Contains(image[index:], "/") {
+		return image[index+1:]
+	}
+
+	if hasDigest {
+		return ""
+	}
+
+	return "latest"
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
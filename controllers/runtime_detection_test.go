@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"testing"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRuntimeDetection(t *testing.T) {
+	assert := require.New(t)
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Annotations = map[string]string{RuntimeAnnotation + ".annotated": "python"}
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	autoMatcher := &rookout.Matcher{Runtime: rookout.AutoRuntime}
+
+	containers := map[rookout.Runtime]v1.Container{
+		rookout.JavaRuntime:   {Name: "by-args", Command: []string{"sh", "-c"}, Args: []string{"exec java -jar /app/app.jar"}},
+		rookout.PythonRuntime: {Name: "annotated", Image: "openjdk:11"},
+		rookout.NodeRuntime:   {Name: "by-env", Env: []v1.EnvVar{{Name: "NODE_VERSION", Value: "14"}}},
+		rookout.DotNetRuntime: {Name: "by-image", Image: "mcr.microsoft.com/dotnet/aspnet:5.0"},
+		"":                    {Name: "unknown", Image: "registry:5000/golang-service:1.0"},
+	}
+
+	for expectedRuntime, container := range containers {
+		runtime, _ := resolveContainerRuntime(workload, container, autoMatcher)
+		assert.Equal(expectedRuntime, runtime, container.Name)
+	}
+
+	images := map[string]rookout.Runtime{
+		"eclipse-temurin:17":                   rookout.JavaRuntime,
+		"docker.io/library/node:14-alpine":     rookout.NodeRuntime,
+		"registry:5000/bitnami/python:3.9":     rookout.PythonRuntime,
+		"gcr.io/distroless/nodejs":             rookout.NodeRuntime,
+		"mcr.microsoft.com/dotnet/runtime:5.0": rookout.DotNetRuntime,
+		// Image names containing a runtime's name
+		"prom/node-exporter:v1.0.1":                     "",
+		"quay.io/prometheus/node-exporter":              "",
+		"bitnami/prometheus-node-exporter:1.0.1":        "",
+		"registry:5000/javascript-linter:1.0":           "",
+		"jupyter/pythonic-notebook":                     "",
+		"registry:5000/runtime:1.0":                     "",
+		"mcr.microsoft.com/dotnet-buildtools/prereqs:1": "",
+	}
+	for image, expectedRuntime := range images {
+		runtime, _ := resolveContainerRuntime(workload, v1.Container{Image: image}, autoMatcher)
+		assert.Equal(expectedRuntime, runtime, image)
+	}
+
+	runtime, _ := resolveContainerRuntime(workload, v1.Container{Command: []string{"/usr/bin/python3.9"}}, autoMatcher)
+	assert.Equal(rookout.PythonRuntime, runtime)
+
+	runtime, _ = resolveContainerRuntime(workload, containers[""], &rookout.Matcher{})
+	assert.Equal(rookout.JavaRuntime, runtime)
+}
+
+func TestImageRepository(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("openjdk", imageRepository("openjdk:11"))
+	assert.Equal("registry:5000/payments/api", imageRepository("registry:5000/payments/api:1.0"))
+	assert.Equal("registry:5000/payments/api", imageRepository("registry:5000/payments/api"))
+	assert.Equal("python", imageRepository("python@sha256:abcd"))
+}
+
+func TestImageTag(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal("11", imageTag("openjdk:11"))
+	assert.Equal("1.0", imageTag("registry:5000/payments/api:1.0"))
+	assert.Equal("latest", imageTag("registry:5000/payments/api"))
+	assert.Equal("", imageTag("python@sha256:abcd"))
+	assert.Equal("3.9", imageTag("python:3.9@sha256:abcd"))
+}
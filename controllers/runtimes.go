@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	core "k8s.io/api/core/v1"
+)
+
+// Each runtime loads the agent (copied to the shared volume by the init container) using its own env vars
+const (
+	// Starts the agent built for the container's libc (glibc or musl)
+	nodeAgentPath = "node/auto_start.js"
+	// The .NET agent comes from the Rookout NuGet package (https://www.nuget.org/packages/Rookout), the init container
+	// images copy its lib/netcoreapp3.1 assemblies to dotnet/startup_hook and their build fails without this assembly
+	dotnetStartupHookPath = "dotnet/startup_hook/Rookout.StartupHook.dll"
+	// Set (with CORECLR_ENABLE_PROFILING and CORECLR_PROFILER_PATH) by previous versions, which loaded an unverified CLR
+	// profiler. Only removed when unpatching workloads patched by these versions
+	legacyDotnetProfilerGUID = "{3D3B8B3A-0F6A-4C41-9B3C-6E0B7A1D2F4E}"
+)
+
+type runtimeInjector interface {
+	addAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar
+	// Called for every runtime when unpatching, since we don't know which runtime was injected
+	removeAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar
+}
+
+var runtimeInjectors = map[rookoutv1alpha1.Runtime]runtimeInjector{
+	rookoutv1alpha1.JavaRuntime:   javaInjector{},
+	rookoutv1alpha1.PythonRuntime: pythonInjector{},
+	rookoutv1alpha1.NodeRuntime:   nodeInjector{},
+	rookoutv1alpha1.DotNetRuntime: dotnetInjector{},
+}
+
+func getRuntimeInjector(runtime rookoutv1alpha1.Runtime) runtimeInjector {
+	if injector, ok := runtimeInjectors[runtime]; ok {
+		return injector
+	}
+
+	return runtimeInjectors[rookoutv1alpha1.JavaRuntime]
+}
+
+// mountPath is where the configuration injecting the agent mounts the shared volume
+func agentPath(mountPath string, relativePath string) string {
+	return fmt.Sprintf("%s/%s", mountPath, relativePath)
+}
+
+type javaInjector struct{}
+
+func (javaInjector) addAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return mergeEnvVar(env, "JAVA_TOOL_OPTIONS", "-javaagent:"+agentPath(mountPath, "rook.jar"), " ", false)
+}
+
+func (javaInjector) removeAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return removeFromEnvVar(env, "JAVA_TOOL_OPTIONS", " ", "rook.jar")
+}
+
+// The python directory only holds a sitecustomize module, which python imports on startup from PYTHONPATH (prepended
+// to shadow the application's own sitecustomize, which it chains to). It appends the rook build matching the
+// interpreter's version and libc to sys.path and starts rook, so rook's dependencies never shadow the application's
+type pythonInjector struct{}
+
+func (pythonInjector) addAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return mergeEnvVar(env, "PYTHONPATH", agentPath(mountPath, "python"), ":", true)
+}
+
+func (pythonInjector) removeAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return removeFromEnvVar(env, "PYTHONPATH", ":", agentPath(mountPath, "python"))
+}
+
+// The node agent is preloaded using NODE_OPTIONS, the "=" form keeps the option a single value we can remove
+type nodeInjector struct{}
+
+func (nodeInjector) addAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return mergeEnvVar(env, "NODE_OPTIONS", "--require="+agentPath(mountPath, nodeAgentPath), " ", false)
+}
+
+func (nodeInjector) removeAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return removeFromEnvVar(env, "NODE_OPTIONS", " ", agentPath(mountPath, nodeAgentPath))
+}
+
+// The agent is loaded by a startup hook, which doesn't conflict with the CLR profiler (APM) a container might use
+type dotnetInjector struct{}
+
+var legacyDotnetProfilerEnvVars = []string{"CORECLR_ENABLE_PROFILING", "CORECLR_PROFILER", "CORECLR_PROFILER_PATH"}
+
+func (dotnetInjector) addAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	return mergeEnvVar(env, "DOTNET_STARTUP_HOOKS", agentPath(mountPath, dotnetStartupHookPath), ":", false)
+}
+
+func (dotnetInjector) removeAgentEnvVars(env []core.EnvVar, mountPath string) []core.EnvVar {
+	env = removeFromEnvVar(env, "DOTNET_STARTUP_HOOKS", ":", agentPath(mountPath, dotnetStartupHookPath))
+
+	if profiler := findEnvVar(env, "CORECLR_PROFILER"); profiler == nil || profiler.Value != legacyDotnetProfilerGUID {
+		return env
+	}
+
+	var updatedEnvVars []core.EnvVar
+	for _, envVar := range env {
+		if !containsString(legacyDotnetProfilerEnvVars, envVar.Name) {
+			updatedEnvVars = append(updatedEnvVars, envVar)
+		}
+	}
+
+	return updatedEnvVars
+}
+
+func findEnvVar(env []core.EnvVar, name string) *core.EnvVar {
+	for index := range env {
+		if env[index].Name == name {
+			return &env[index]
+		}
+	}
+
+	return nil
+}
+
+func setEnvVar(env []core.EnvVar, name string, value string) []core.EnvVar {
+	if envVar := findEnvVar(env, name); envVar != nil {
+		envVar.Value = value
+		return env
+	}
+
+	return append(env, core.EnvVar{Name: name, Value: value})
+}
+
+// Adds value to the env var, keeping its existing value (if any) separated by separator
+func mergeEnvVar(env []core.EnvVar, name string, value string, separator string, prepend bool) []core.EnvVar {
+	for index, envVar := range env {
+		if envVar.Name != name {
+			continue
+		}
+
+		if prepend {
+			env[index].Value = value + separator + envVar.Value
+		} else {
+			env[index].Value = envVar.Value + separator + value
+		}
+
+		return env
+	}
+
+	return append(env, core.EnvVar{Name: name, Value: value})
+}
+
+// Reverts mergeEnvVar, the env var is dropped when no other value is left in it
+func removeFromEnvVar(env []core.EnvVar, name string, separator string, suffix string) []core.EnvVar {
+	var updatedEnvVars []core.EnvVar
+
+	for _, envVar := range env {
+		if envVar.Name == name {
+			values := removeElementWithSuffix(strings.Split(envVar.Value, separator), suffix)
+
+			if len(values) == 0 {
+				continue
+			}
+
+			envVar.Value = strings.Join(values, separator)
+		}
+
+		updatedEnvVars = append(updatedEnvVars, envVar)
+	}
+
+	return updatedEnvVars
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Keep the status far below the size limit of objects in etcd (1.5MiB) on large clusters, each list of workloads only
+// holds the first ones (their count is reported next to it) and every dry run patch is logged in full
+const (
+	MaxStatusWorkloads   = 100
+	MaxDryRunPatchLength = 4096
+)
+
+// Workload syncs update the status of the configurations at most this often
+const StatusUpdateInterval = 5 * time.Second
+
+// Reports the operator's state (configuration validity and last sync of every workload it matches) in the status of
+// every configuration, the status is only updated when it changes
+func (r *RookoutReconciler) updateStatus(ctx context.Context) error {
+	for _, configuration := range configurations.List() {
+		err := r.updateConfigurationStatus(ctx, configuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Called once a workload is synced. Syncing many workloads (on startup or when a configuration changes) would otherwise
+// rebuild and write the status of every configuration for each of them, the updates are batched by runStatusUpdates
+func (r *RookoutReconciler) requestStatusUpdate(ctx context.Context) error {
+	if r.statusUpdates == nil {
+		return r.updateStatus(ctx)
+	}
+
+	select {
+	case r.statusUpdates <- struct{}{}:
+	default:
+		// An update is already pending
+	}
+
+	return nil
+}
+
+// Updates the status of the configurations when requested, at most every StatusUpdateInterval, until the context is done
+func (r *RookoutReconciler) runStatusUpdates(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.statusUpdates:
+		}
+
+		err := r.updateStatus(ctx)
+		if err != nil {
+			logrus.Errorf("Failed to update the status of the configurations, retrying: %v", err)
+			_ = r.requestStatusUpdate(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(StatusUpdateInterval):
+		}
+	}
+}
+
+func (r *RookoutReconciler) updateConfigurationStatus(ctx context.Context, configuration *OperatorConfiguration) error {
+	config := rookoutv1alpha1.Rookout{}
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: configuration.Namespace, Name: configuration.Name}, &config)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	status := buildStatus(configuration, config.Status, r.DeploymentsManager.ListSyncResults())
+	if equality.Semantic.DeepEqual(config.Status, status) {
+		return nil
+	}
+
+	previousStatus := config.Status
+	config.Status = status
+	err = r.Client.Status().Update(ctx, &config)
+	if err != nil {
+		if apierrors.IsConflict(err) {
+			logrus.Infof("Configuration %s changed while updating its status, will be updated on next sync", configuration.key())
+			return nil
+		}
+		return err
+	}
+
+	r.recordStatusEvents(&config, previousStatus)
+
+	return nil
+}
+
+func buildStatus(configuration *OperatorConfiguration, currentStatus rookoutv1alpha1.RookoutStatus, syncResults map[string]*WorkloadSyncResult) rookoutv1alpha1.RookoutStatus {
+	status := rookoutv1alpha1.RookoutStatus{
+		ObservedGeneration: configuration.Generation,
+		Conditions:         append([]metav1.Condition{}, currentStatus.Conditions...),
+	}
+
+	readyCondition := metav1.Condition{
+		Type:               rookoutv1alpha1.ReadyCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: configuration.Generation,
+		Reason:             configuration.readyReason,
+		Message:            configuration.readyMessage,
+	}
+	if configuration.isReady {
+		readyCondition.Status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&status.Conditions, readyCondition)
+
+	keys := make([]string, 0, len(syncResults))
+	for key := range syncResults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result := syncResults[key]
+		if result.configuration != configuration.key() {
+			continue
+		}
+
+		if result.isMatched {
+			status.MatchedWorkloads = appendWorkloadStatus(status.MatchedWorkloads, &status.MatchedCount,
+				rookoutv1alpha1.WorkloadStatus{Kind: result.Kind, Namespace: result.Namespace, Name: result.Name, Matchers: result.Matchers})
+		}
+
+		if result.isPatched {
+			status.PatchedWorkloads = appendWorkloadStatus(status.PatchedWorkloads, &status.PatchedCount,
+				rookoutv1alpha1.WorkloadStatus{Kind: result.Kind, Namespace: result.Namespace, Name: result.Name})
+		}
+
+		if result.isFailed {
+			status.FailedWorkloads = appendWorkloadStatus(status.FailedWorkloads, &status.FailedCount, result.WorkloadStatus)
+		}
+
+		if result.isPending {
+			status.PendingWorkloads = appendWorkloadStatus(status.PendingWorkloads, &status.PendingCount, result.WorkloadStatus)
+		}
+
+		if result.isQuarantined {
+			status.QuarantinedWorkloads = appendWorkloadStatus(status.QuarantinedWorkloads, &status.QuarantinedCount, result.WorkloadStatus)
+		}
+
+		if result.dryRunPatch != "" {
+			status.DryRunWorkloads = appendWorkloadStatus(status.DryRunWorkloads, &status.DryRunCount,
+				rookoutv1alpha1.WorkloadStatus{Kind: result.Kind, Namespace: result.Namespace, Name: result.Name, Matchers: result.Matchers, Patch: truncateDryRunPatch(result.dryRunPatch)})
+		}
+	}
+
+	return status
+}
+
+// Counts the workload, which is only listed while the list is shorter than MaxStatusWorkloads
+func appendWorkloadStatus(workloads []rookoutv1alpha1.WorkloadStatus, count *int, workload rookoutv1alpha1.WorkloadStatus) []rookoutv1alpha1.WorkloadStatus {
+	*count++
+	if len(workloads) >= MaxStatusWorkloads {
+		return workloads
+	}
+
+	return append(workloads, workload)
+}
+
+func truncateDryRunPatch(patch string) string {
+	if len(patch) <= MaxDryRunPatchLength {
+		return patch
+	}
+
+	return patch[:MaxDryRunPatchLength] + "... (truncated, the full patch is in the operator's logs)"
+}
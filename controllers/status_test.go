@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestBuildStatus(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := &OperatorConfiguration{readyReason: "NoMatchers", readyMessage: "No matchers found in configuration"}
+	configuration.Namespace = "default"
+	configuration.Name = "rookout"
+	configuration.Generation = 3
+	otherConfiguration := &OperatorConfiguration{}
+	otherConfiguration.Namespace = "default"
+	otherConfiguration.Name = "other"
+
+	manager := NewDeploymentsManager()
+	for _, name := range []string{"patched", "matched", "failed", "ignored", "other"} {
+		deployment := &apps.Deployment{}
+		deployment.Name = name
+		deployment.Namespace = "default"
+		workload, err := newWorkload(deployment)
+		assert.NoError(err)
+
+		switch name {
+		case "patched":
+			manager.SetSyncResult(workload, configuration, true, "", nil)
+		case "matched":
+			manager.SetSyncResult(workload, configuration, false, "", nil)
+		case "failed":
+			manager.SetSyncResult(workload, configuration, false, "", errors.New("patch failed"))
+		case "ignored":
+			manager.SetSyncResult(workload, nil, false, "", nil)
+		case "other":
+			manager.SetSyncResult(workload, otherConfiguration, true, "", nil)
+		}
+	}
+
+	status := buildStatus(configuration, rookout.RookoutStatus{}, manager.ListSyncResults())
+	assert.Equal(int64(3), status.ObservedGeneration)
+	assert.True(meta.IsStatusConditionFalse(status.Conditions, rookout.ReadyCondition))
+	assert.Equal("NoMatchers", meta.FindStatusCondition(status.Conditions, rookout.ReadyCondition).Reason)
+	assert.Equal(3, status.MatchedCount)
+	assert.Equal(1, status.PatchedCount)
+	assert.Equal("patched", status.PatchedWorkloads[0].Name)
+	assert.Equal(1, status.FailedCount)
+	assert.Equal(rookout.WorkloadStatus{Kind: rookout.DeploymentKind, Namespace: "default", Name: "failed", Message: "patch failed"}, status.FailedWorkloads[0])
+
+	// Transition time is kept as long as the condition's status doesn't change
+	configuration.readyReason = "MissingRookoutConnection"
+	updatedStatus := buildStatus(configuration, status, manager.ListSyncResults())
+	assert.Equal(meta.FindStatusCondition(status.Conditions, rookout.ReadyCondition).LastTransitionTime, meta.FindStatusCondition(updatedStatus.Conditions, rookout.ReadyCondition).LastTransitionTime)
+
+	configuration.isReady = true
+	updatedStatus = buildStatus(configuration, status, manager.ListSyncResults())
+	assert.Equal(metav1.ConditionTrue, meta.FindStatusCondition(updatedStatus.Conditions, rookout.ReadyCondition).Status)
+}
+
+func TestBuildStatusLimits(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := &OperatorConfiguration{}
+	configuration.Namespace = "default"
+	configuration.Name = "rookout"
+
+	manager := NewDeploymentsManager()
+	for i := 0; i < MaxStatusWorkloads+5; i++ {
+		deployment := &apps.Deployment{}
+		deployment.Name = fmt.Sprintf("api-%03d", i)
+		deployment.Namespace = "default"
+		workload, err := newWorkload(deployment)
+		assert.NoError(err)
+
+		patch := `[{"op":"add","path":"/metadata/annotations"}]`
+		if i == 0 {
+			patch = strings.Repeat("a", MaxDryRunPatchLength+1)
+		}
+		manager.SetSyncResult(workload, configuration, false, patch, nil)
+
+		deployment.Name = fmt.Sprintf("web-%03d", i)
+		manager.SetSyncResult(workload, configuration, false, "", errors.New("patch failed"))
+	}
+
+	status := buildStatus(configuration, rookout.RookoutStatus{}, manager.ListSyncResults())
+	assert.Equal(2*(MaxStatusWorkloads+5), status.MatchedCount)
+	assert.Len(status.MatchedWorkloads, MaxStatusWorkloads)
+	assert.Equal(MaxStatusWorkloads+5, status.FailedCount)
+	assert.Len(status.FailedWorkloads, MaxStatusWorkloads)
+	assert.Equal("web-000", status.FailedWorkloads[0].Name)
+
+	assert.Equal(MaxStatusWorkloads+5, status.DryRunCount)
+	assert.Len(status.DryRunWorkloads, MaxStatusWorkloads)
+	assert.Equal("api-000", status.DryRunWorkloads[0].Name)
+	assert.True(strings.HasPrefix(status.DryRunWorkloads[0].Patch, strings.Repeat("a", MaxDryRunPatchLength)+"... (truncated"))
+	assert.Equal(`[{"op":"add","path":"/metadata/annotations"}]`, status.DryRunWorkloads[1].Patch)
+}
+
+func TestStatusUpdates(t *testing.T) {
+	assert := require.New(t)
+	useTestConfigurations(t)
+
+	config := newTestConfiguration("default", "rookout", time.Now(), rookout.Matcher{})
+	configurations.Update(newOperatorConfiguration(config))
+	reconciler := newTestReconciler(t, &config)
+	reconciler.statusUpdates = make(chan struct{}, 1)
+
+	// Batched, nothing is written until the updater runs
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(reconciler.requestStatusUpdate(ctx))
+	assert.NoError(reconciler.requestStatusUpdate(ctx))
+	assert.Len(reconciler.statusUpdates, 1)
+
+	getStatus := func() rookout.RookoutStatus {
+		current := &rookout.Rookout{}
+		assert.NoError(reconciler.Client.Get(ctx, types.NamespacedName{Namespace: "default", Name: "rookout"}, current))
+		return current.Status
+	}
+	assert.Empty(getStatus().Conditions)
+
+	done := make(chan error)
+	go func() { done <- reconciler.runStatusUpdates(ctx) }()
+	assert.Eventually(func() bool {
+		return meta.IsStatusConditionTrue(getStatus().Conditions, rookout.ReadyCondition)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(<-done)
+}
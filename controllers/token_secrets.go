@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	DefaultTokenSecretKey = "token"
+	// Token secrets are read from the API server (caching every secret of the cluster isn't an option), this is how
+	// often they are read to find rotated secrets
+	TokenSecretsPollInterval = time.Minute
+	// Set on the pod template of workloads using a token secret, changing it when the secret rotates rolls out the workload
+	TokenHashAnnotation = "rookout.com/token-hash"
+	// Set on secrets copied by the operator, holds the namespace/name of the copied secret
+	CopiedSecretAnnotation = "rookout.com/copied-from"
+)
+
+// Secrets are only read one by one, never listed or watched. Creating and updating them is needed to copy token
+// secrets to the namespaces of the workloads (copy_to_namespaces)
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update
+
+func tokenSecretKey(ref *rookoutv1alpha1.TokenSecretRef) string {
+	return getConfigStr(ref.Key, DefaultTokenSecretKey)
+}
+
+// The token is never copied into the workload, pods read it from the secret in their own namespace
+func tokenSecretEnvVar(ref *rookoutv1alpha1.TokenSecretRef) core.EnvVar {
+	return core.EnvVar{
+		Name: RookoutTokenEnvVar,
+		ValueFrom: &core.EnvVarSource{
+			SecretKeyRef: &core.SecretKeySelector{
+				LocalObjectReference: core.LocalObjectReference{Name: ref.Name},
+				Key:                  tokenSecretKey(ref),
+			},
+		},
+	}
+}
+
+func setTokenHashAnnotation(podTemplate *core.PodTemplateSpec, tokenHash string) {
+	if tokenHash == "" {
+		delete(podTemplate.Annotations, TokenHashAnnotation)
+		return
+	}
+
+	if podTemplate.Annotations == nil {
+		podTemplate.Annotations = map[string]string{}
+	}
+	podTemplate.Annotations[TokenHashAnnotation] = tokenHash
+}
+
+// Makes sure every token secret referenced by the configuration exists (the configuration isn't ready otherwise)
+// and hashes their tokens, so we know when a secret rotated
+func (r *RookoutReconciler) resolveTokenSecrets(ctx context.Context, configuration *OperatorConfiguration) error {
+	if !configuration.isReady {
+		return nil
+	}
+
+	tokenHash, reason, message, err := r.hashTokenSecrets(ctx, configuration)
+	if err != nil {
+		return err
+	}
+
+	if reason != "" {
+		logrus.Errorf("Configuration %s isn't ready, %s", configuration.key(), message)
+		configuration.isReady = false
+		configuration.readyReason = reason
+		configuration.readyMessage = message
+		return nil
+	}
+
+	configuration.tokenHash = tokenHash
+	return nil
+}
+
+// Returns the hash of the tokens of the configuration's token secrets, or why the configuration can't be ready when one
+// of them is missing. Empty when the configuration has no token secret
+func (r *RookoutReconciler) hashTokenSecrets(ctx context.Context, configuration *OperatorConfiguration) (string, string, string, error) {
+	hash := sha256.New()
+	hasTokenSecret := false
+
+	for i, matcher := range configuration.Spec.Matchers {
+		if matcher.TokenSecretRef == nil {
+			continue
+		}
+
+		secret := &core.Secret{}
+		err := r.uncachedReader().Get(ctx, types.NamespacedName{Namespace: configuration.Namespace, Name: matcher.TokenSecretRef.Name}, secret)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return "", "", "", err
+			}
+
+			return "", "TokenSecretNotFound", fmt.Sprintf("Matcher #%d token secret %s not found", i, matcher.TokenSecretRef.Name), nil
+		}
+
+		token, ok := secret.Data[tokenSecretKey(matcher.TokenSecretRef)]
+		if !ok {
+			return "", "TokenSecretKeyNotFound", fmt.Sprintf("Matcher #%d token secret %s has no %s key", i, matcher.TokenSecretRef.Name, tokenSecretKey(matcher.TokenSecretRef)), nil
+		}
+
+		hasTokenSecret = true
+		hash.Write([]byte(matcher.TokenSecretRef.Name + "/" + tokenSecretKey(matcher.TokenSecretRef) + "="))
+		hash.Write(token)
+	}
+
+	if !hasTokenSecret {
+		return "", "", "", nil
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))[:16], "", "", nil
+}
+
+// Copies the token secrets of the configuration which should be copied to the given namespace, copies are updated
+// when the secret rotates. Existing secrets which weren't copied by the operator are never overridden
+func (r *RookoutReconciler) copyTokenSecrets(ctx context.Context, configuration *OperatorConfiguration, namespace string) error {
+	for _, matcher := range configuration.Spec.Matchers {
+		if matcher.TokenSecretRef == nil || !matcher.TokenSecretRef.CopyToNamespaces || namespace == configuration.Namespace {
+			continue
+		}
+
+		secret := &core.Secret{}
+		secretName := types.NamespacedName{Namespace: configuration.Namespace, Name: matcher.TokenSecretRef.Name}
+		err := r.uncachedReader().Get(ctx, secretName, secret)
+		if err != nil {
+			return err
+		}
+
+		copiedSecret := &core.Secret{}
+		err = r.uncachedReader().Get(ctx, types.NamespacedName{Namespace: namespace, Name: secret.Name}, copiedSecret)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+
+			copiedSecret = &core.Secret{Type: secret.Type, Data: secret.Data}
+			copiedSecret.Namespace = namespace
+			copiedSecret.Name = secret.Name
+			copiedSecret.Annotations = map[string]string{CopiedSecretAnnotation: secretName.String()}
+
+			logrus.Infof("Copying token secret %s to namespace %s", secretName, namespace)
+			err = r.Client.Create(ctx, copiedSecret)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if copiedSecret.Annotations[CopiedSecretAnnotation] != secretName.String() {
+			return fmt.Errorf("secret %s/%s already exists and wasn't copied from %s", namespace, secret.Name, secretName)
+		}
+
+		if equality.Semantic.DeepEqual(copiedSecret.Data, secret.Data) {
+			continue
+		}
+
+		logrus.Infof("Updating token secret %s copied to namespace %s", secretName, namespace)
+		copiedSecret.Data = secret.Data
+		err = r.Client.Update(ctx, copiedSecret)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Enqueues the configurations whose token secrets were created, deleted or rotated, until the context is done
+func (r *RookoutReconciler) pollTokenSecrets(ctx context.Context) error {
+	ticker := time.NewTicker(TokenSecretsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.checkTokenSecrets(ctx)
+		}
+	}
+}
+
+func (r *RookoutReconciler) checkTokenSecrets(ctx context.Context) {
+	for _, configuration := range configurations.List() {
+		tokenSecretReason := ""
+		if configuration.readyReason == "TokenSecretNotFound" || configuration.readyReason == "TokenSecretKeyNotFound" {
+			tokenSecretReason = configuration.readyReason
+		} else if !configuration.isReady {
+			continue
+		}
+
+		tokenHash, reason, _, err := r.hashTokenSecrets(ctx, configuration)
+		if err != nil {
+			logrus.Errorf("Failed to read token secrets of configuration %s: %v", configuration.key(), err)
+			continue
+		}
+
+		if tokenHash == configuration.tokenHash && reason == tokenSecretReason {
+			continue
+		}
+
+		logrus.Infof("Token secrets of configuration %s changed", configuration.key())
+		config := &rookoutv1alpha1.Rookout{}
+		config.Namespace = configuration.Namespace
+		config.Name = configuration.Name
+		r.configurationEvents <- event.GenericEvent{Object: config}
+	}
+}
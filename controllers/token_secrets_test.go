@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestTokenSecretInjection(t *testing.T) {
+	assert := require.New(t)
+
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{
+		{TokenSecretRef: &rookout.TokenSecretRef{Name: "rookout-token"}},
+	}}})
+	assert.True(configuration.isReady)
+	configuration.tokenHash = "0123456789abcdef"
+
+	deployment := apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+	original := deployment.DeepCopy()
+
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+
+	injectAgent(configuration, workload)
+	assert.Equal(v1.EnvVar{
+		Name: RookoutTokenEnvVar,
+		ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: "rookout-token"},
+			Key:                  DefaultTokenSecretKey,
+		}},
+	}, deployment.Spec.Template.Spec.Containers[0].Env[0])
+	assert.Equal("0123456789abcdef", deployment.Spec.Template.Annotations[TokenHashAnnotation])
+
+	removeAgent(workload)
+	assert.Equal(original.Spec.Template.Spec, deployment.Spec.Template.Spec)
+	assert.NotContains(deployment.Spec.Template.Annotations, TokenHashAnnotation)
+}
+
+func TestCheckTokenSecrets(t *testing.T) {
+	assert := require.New(t)
+	ctx := context.Background()
+	useTestConfigurations(t)
+
+	config := rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{
+		{TokenSecretRef: &rookout.TokenSecretRef{Name: "rookout-token"}},
+	}}}
+	config.Namespace = "team-a"
+	config.Name = "rookout"
+
+	secret := &v1.Secret{Data: map[string][]byte{DefaultTokenSecretKey: []byte("token")}}
+	secret.Namespace = "team-a"
+	secret.Name = "rookout-token"
+
+	reconciler := newTestReconciler(t, secret)
+	reconciler.configurationEvents = make(chan event.GenericEvent, 1)
+
+	configuration := newOperatorConfiguration(config)
+	assert.NoError(reconciler.resolveTokenSecrets(ctx, configuration))
+	assert.True(configuration.isReady)
+	assert.NotEmpty(configuration.tokenHash)
+	configurations.Update(configuration)
+
+	reconciler.checkTokenSecrets(ctx)
+	assert.Empty(reconciler.configurationEvents)
+
+	// Rotated
+	secret.Data[DefaultTokenSecretKey] = []byte("rotated")
+	assert.NoError(reconciler.Client.Update(ctx, secret))
+	reconciler.checkTokenSecrets(ctx)
+	assert.Len(reconciler.configurationEvents, 1)
+	enqueued := <-reconciler.configurationEvents
+	assert.Equal(types.NamespacedName{Namespace: "team-a", Name: "rookout"}, types.NamespacedName{Namespace: enqueued.Object.GetNamespace(), Name: enqueued.Object.GetName()})
+
+	// Missing, until it's created
+	assert.NoError(reconciler.Client.Delete(ctx, secret))
+	configuration = newOperatorConfiguration(config)
+	assert.NoError(reconciler.resolveTokenSecrets(ctx, configuration))
+	assert.False(configuration.isReady)
+	assert.Equal("TokenSecretNotFound", configuration.readyReason)
+	configurations.Update(configuration)
+
+	reconciler.checkTokenSecrets(ctx)
+	assert.Empty(reconciler.configurationEvents)
+
+	secret.ResourceVersion = ""
+	assert.NoError(reconciler.Client.Create(ctx, secret))
+	reconciler.checkTokenSecrets(ctx)
+	assert.Len(reconciler.configurationEvents, 1)
+}
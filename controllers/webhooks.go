@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// !!!!!!!!!!!!!!!!!!!!
+// Webhooks are served only when ENABLE_WEBHOOKS=true, they require a serving certificate (see config/certmanager).
+// System namespaces and the operator's own namespace are excluded by config/webhook/namespace_selector_patch.yaml
+// !!!!!!!!!!!!!!!!!!!!
+// +kubebuilder:webhook:path=/mutate--v1-pod,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=mpod.rookout.com,admissionReviewVersions={v1,v1beta1}
+// +kubebuilder:webhook:path=/mutate-batch-v1-job,mutating=true,failurePolicy=ignore,sideEffects=None,groups=batch,resources=jobs,verbs=create,versions=v1,name=mjob.rookout.com,admissionReviewVersions={v1,v1beta1}
+
+func SetupWebhooksWithManager(mgr ctrl.Manager) {
+	reader := &cacheFirstReader{cache: mgr.GetClient(), apiReader: mgr.GetAPIReader()}
+	mgr.GetWebhookServer().Register("/mutate--v1-pod", &webhook.Admission{Handler: &PodInjector{Reader: reader}})
+	mgr.GetWebhookServer().Register("/mutate-batch-v1-job", &webhook.Admission{Handler: &JobInjector{Reader: reader}})
+}
+
+// Reads from the manager's cache, falling back to the API server for objects created too recently to be cached (a pod's
+// replicaset is usually created right before the pod)
+type cacheFirstReader struct {
+	cache     client.Reader
+	apiReader client.Reader
+}
+
+func (r *cacheFirstReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	err := r.cache.Get(ctx, key, obj)
+	if apierrors.IsNotFound(err) {
+		return r.apiReader.Get(ctx, key, obj)
+	}
+
+	return err
+}
+
+func (r *cacheFirstReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return r.cache.List(ctx, list, opts...)
+}
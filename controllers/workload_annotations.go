@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"sort"
+	"strings"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+)
+
+// Set by app teams on the workload or its pod template (which takes precedence), honored according to the
+// configuration's annotation policy
+const (
+	// "true" or "false"
+	InjectAnnotation = "rookout.com/inject"
+	// Comma separated names of the containers to instrument
+	ContainersAnnotation = "rookout.com/containers"
+	// "rookout.com/env.<NAME>", sets the NAME env var (which must have the ROOKOUT_ prefix) in instrumented containers
+	EnvAnnotationPrefix = "rookout.com/env."
+)
+
+func getWorkloadAnnotation(workload *Workload, name string) (string, bool) {
+	for _, annotations := range []map[string]string{workload.PodTemplate.Annotations, workload.GetAnnotations()} {
+		if value, ok := annotations[name]; ok {
+			return strings.TrimSpace(value), true
+		}
+	}
+
+	return "", false
+}
+
+func getAnnotationPolicy(configuration *OperatorConfiguration) rookoutv1alpha1.AnnotationPolicy {
+	return rookoutv1alpha1.AnnotationPolicy(getConfigStr(string(configuration.Spec.AnnotationPolicy), string(rookoutv1alpha1.OptOutAnnotationPolicy)))
+}
+
+// Merges the workload's annotations with the matcher found for the container, returns the matcher to use (nil if the
+// container shouldn't be instrumented) and the reason when annotations decided for the container
+func applyWorkloadAnnotations(configuration *OperatorConfiguration, workload *Workload, container core.Container, matcher *compiledMatcher) (*compiledMatcher, string) {
+	policy := getAnnotationPolicy(configuration)
+	if policy == rookoutv1alpha1.DisabledAnnotationPolicy {
+		return matcher, ""
+	}
+
+	inject, _ := getWorkloadAnnotation(workload, InjectAnnotation)
+	if strings.EqualFold(inject, "false") {
+		return nil, "disabled by " + InjectAnnotation + " annotation"
+	}
+
+	if containers, ok := getWorkloadAnnotation(workload, ContainersAnnotation); ok {
+		listed := false
+		for _, name := range strings.Split(containers, ",") {
+			if strings.TrimSpace(name) == container.Name {
+				listed = true
+				break
+			}
+		}
+
+		if !listed {
+			return nil, "not listed in " + ContainersAnnotation + " annotation"
+		}
+	}
+
+	if policy != rookoutv1alpha1.OverrideAnnotationPolicy || !strings.EqualFold(inject, "true") {
+		return matcher, ""
+	}
+
+	if matcher != nil && !matcher.Exclude {
+		return matcher, ""
+	}
+
+	if !configuration.appliesToNamespace(workload.GetNamespace()) {
+		return nil, "namespace is out of the configuration's scope"
+	}
+
+	// Opted in, using the first matcher able to inject the agent
+	for _, defaultMatcher := range configuration.matchers {
+		if !defaultMatcher.Exclude {
+			return defaultMatcher, "opted in by " + InjectAnnotation + " annotation"
+		}
+	}
+
+	return nil, "no matcher to opt in with"
+}
+
+// Env vars set by the workload's annotations, sorted by name. The token can't be set by annotations
+func getAnnotationEnvVars(configuration *OperatorConfiguration, workload *Workload) []core.EnvVar {
+	if getAnnotationPolicy(configuration) == rookoutv1alpha1.DisabledAnnotationPolicy {
+		return nil
+	}
+
+	values := map[string]string{}
+	// Pod template annotations are applied last, so they take precedence
+	for _, annotations := range []map[string]string{workload.GetAnnotations(), workload.PodTemplate.Annotations} {
+		for key, value := range annotations {
+			if strings.HasPrefix(key, EnvAnnotationPrefix) {
+				values[strings.TrimPrefix(key, EnvAnnotationPrefix)] = value
+			}
+		}
+	}
+
+	var envVars []core.EnvVar
+	for name, value := range values {
+		if !strings.HasPrefix(name, RookoutEnvVarPreffix) || name == RookoutTokenEnvVar {
+			logrus.Warnf("Ignoring %s%s annotation of %s, only %s env vars (except %s) can be set by annotations", EnvAnnotationPrefix, name, workload, RookoutEnvVarPreffix, RookoutTokenEnvVar)
+			continue
+		}
+
+		envVars = append(envVars, core.EnvVar{Name: name, Value: value})
+	}
+
+	sort.Slice(envVars, func(i, j int) bool {
+		return envVars[i].Name < envVars[j].Name
+	})
+
+	return envVars
+}
+
+// Annotation env vars override the matcher's env vars
+func setAnnotationEnvVars(env []core.EnvVar, envVars []core.EnvVar) []core.EnvVar {
+	for _, envVar := range envVars {
+		if existing := findEnvVar(env, envVar.Name); existing != nil {
+			existing.ValueFrom = nil
+		}
+		env = setEnvVar(env, envVar.Name, envVar.Value)
+	}
+
+	return env
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"testing"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWorkloadAnnotations(t *testing.T) {
+	assert := require.New(t)
+
+	token := []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}, {Name: "ROOKOUT_LABELS", Value: "team:x"}}
+	configuration := newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{
+		{Deployment: "api", DeploymentMatchMode: rookout.ExactMatchMode, EnvVars: token},
+	}}})
+
+	deployment := apps.Deployment{}
+	deployment.Name = "api"
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}, {Name: "worker"}}
+	workload, err := newWorkload(&deployment)
+	assert.NoError(err)
+	assert.Equal("app=#0,worker=#0", describeWorkloadMatchers(configuration, workload))
+
+	// Opting out, pod template annotations take precedence
+	deployment.Annotations = map[string]string{InjectAnnotation: "true"}
+	deployment.Spec.Template.Annotations = map[string]string{InjectAnnotation: "false"}
+	assert.False(isWorkloadMatched(configuration, workload))
+	_, _, reason := findContainerInjection(configuration, workload, deployment.Spec.Template.Spec.Containers[0])
+	assert.Equal("disabled by rookout.com/inject annotation", reason)
+
+	deployment.Spec.Template.Annotations = map[string]string{
+		ContainersAnnotation:                      "worker",
+		EnvAnnotationPrefix + "ROOKOUT_LABELS":    "team:y",
+		EnvAnnotationPrefix + RookoutTokenEnvVar:  "stolen",
+		EnvAnnotationPrefix + "JAVA_TOOL_OPTIONS": "-Xmx1g",
+		EnvAnnotationPrefix + "ROOKOUT_DEBUG":     "1",
+	}
+	assert.Equal("worker=#0", describeWorkloadMatchers(configuration, workload))
+
+	injectAgent(configuration, workload)
+	assert.Empty(deployment.Spec.Template.Spec.Containers[0].Env)
+	assert.Equal([]v1.EnvVar{
+		{Name: RookoutTokenEnvVar, Value: "token"},
+		{Name: "ROOKOUT_LABELS", Value: "team:y"},
+		{Name: "ROOKOUT_DEBUG", Value: "1"},
+		{Name: "JAVA_TOOL_OPTIONS", Value: "-javaagent:/rookout/rook.jar"},
+	}, deployment.Spec.Template.Spec.Containers[1].Env)
+	removeAgent(workload)
+
+	// Annotations can't opt in unless the policy allows it
+	deployment.Name = "web"
+	deployment.Spec.Template.Annotations = map[string]string{InjectAnnotation: "true"}
+	assert.False(isWorkloadMatched(configuration, workload))
+
+	configuration = newOperatorConfiguration(rookout.Rookout{Spec: rookout.RookoutSpec{
+		AnnotationPolicy: rookout.OverrideAnnotationPolicy,
+		Matchers:         configuration.Spec.Matchers,
+	}})
+	assert.Equal("app=#0,worker=#0", describeWorkloadMatchers(configuration, workload))
+
+	// Annotations are ignored
+	configuration.Spec.AnnotationPolicy = rookout.DisabledAnnotationPolicy
+	assert.False(isWorkloadMatched(configuration, workload))
+	deployment.Name = "api"
+	deployment.Spec.Template.Annotations = map[string]string{InjectAnnotation: "false"}
+	assert.True(isWorkloadMatched(configuration, workload))
+	assert.Empty(getAnnotationEnvVars(configuration, workload))
+}
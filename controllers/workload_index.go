@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// Cache index of the workloads patched by each configuration (namespace/name of the configuration)
+const ConfigurationIndexField = "rookout.configuration"
+
+func workloadConfigurationIndex(obj client.Object) []string {
+	workload, err := newWorkload(obj)
+	if err != nil {
+		return nil
+	}
+
+	configuration, ok := workload.PodTemplate.Annotations[ConfigurationAnnotation]
+	if !ok {
+		return nil
+	}
+
+	return []string{configuration}
+}
+
+// Enqueues the workloads affected by a configuration change: the ones it patched (to update or unpatch them) and, when
+// it is ready, every workload in its scope since any of them might be matched now. Workloads are synced by their
+// controller, the configuration controller never patches them itself
+func (r *RookoutReconciler) enqueueConfigurationWorkloads(ctx context.Context, key types.NamespacedName, configuration *OperatorConfiguration) error {
+	for _, kind := range supportedWorkloadKinds {
+		enqueued := map[types.NamespacedName]bool{}
+		enqueue := func(obj runtime.Object) error {
+			workload, err := newWorkload(obj.(client.Object))
+			if err != nil {
+				return err
+			}
+
+			if !enqueued[workload.NamespacedName()] {
+				enqueued[workload.NamespacedName()] = true
+				r.workloadEvents[kind] <- event.GenericEvent{Object: workload.Object}
+			}
+			return nil
+		}
+
+		patched, err := newWorkloadList(kind)
+		if err != nil {
+			return err
+		}
+
+		err = r.Client.List(ctx, patched, client.MatchingFields{ConfigurationIndexField: key.String()})
+		if err != nil {
+			return err
+		}
+
+		err = meta.EachListItem(patched, enqueue)
+		if err != nil {
+			return err
+		}
+
+		if configuration == nil || !configuration.isReady {
+			continue
+		}
+
+		var options []client.ListOption
+		if configuration.Spec.Scope == rookoutv1alpha1.NamespaceScope {
+			options = append(options, client.InNamespace(configuration.Namespace))
+		}
+
+		inScope, err := newWorkloadList(kind)
+		if err != nil {
+			return err
+		}
+
+		err = r.Client.List(ctx, inScope, options...)
+		if err != nil {
+			return err
+		}
+
+		err = meta.EachListItem(inScope, enqueue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The workloads currently patched by the configuration, read from the cache index (used by the rollout policy and to
+// finalize deleted configurations)
+func (r *RookoutReconciler) listConfigurationWorkloads(ctx context.Context, key types.NamespacedName) ([]*Workload, error) {
+	var workloads []*Workload
+	for _, kind := range supportedWorkloadKinds {
+		patched, err := newWorkloadList(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.Client.List(ctx, patched, client.MatchingFields{ConfigurationIndexField: key.String()})
+		if err != nil {
+			return nil, err
+		}
+
+		err = meta.EachListItem(patched, func(obj runtime.Object) error {
+			workload, err := newWorkload(obj.(client.Object))
+			if err != nil {
+				return err
+			}
+
+			if workload.PodTemplate.Annotations[ConfigurationAnnotation] == key.String() {
+				workloads = append(workloads, workload)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return workloads, nil
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+
+	rookout "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	apps "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWorkloadConfigurationIndex(t *testing.T) {
+	assert := require.New(t)
+
+	config := rookout.Rookout{Spec: rookout.RookoutSpec{Matchers: []rookout.Matcher{
+		{EnvVars: []v1.EnvVar{{Name: RookoutTokenEnvVar, Value: "token"}}},
+	}}}
+	config.Namespace = "team-a"
+	config.Name = "rookout"
+	configuration := newOperatorConfiguration(config)
+
+	deployment := &apps.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []v1.Container{{Name: "app"}}
+	assert.Empty(workloadConfigurationIndex(deployment))
+
+	workload, err := newWorkload(deployment)
+	assert.NoError(err)
+	injectAgent(configuration, workload)
+	assert.Equal([]string{"team-a/rookout"}, workloadConfigurationIndex(deployment))
+
+	removeAgent(workload)
+	assert.Empty(workloadConfigurationIndex(deployment))
+
+	// Not a workload
+	assert.Empty(workloadConfigurationIndex(&v1.Pod{}))
+}
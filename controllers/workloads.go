@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	rookoutv1alpha1 "github.com/rookout/rookout-k8s-operator/api/v1alpha1"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Every workload kind we know how to patch, jobs are not here since they can only be patched on creation
+var supportedWorkloadKinds = []rookoutv1alpha1.WorkloadKind{
+	rookoutv1alpha1.DeploymentKind,
+	rookoutv1alpha1.StatefulSetKind,
+	rookoutv1alpha1.DaemonSetKind,
+	rookoutv1alpha1.CronJobKind,
+}
+
+// Workload wraps a resource which owns a pod template (Deployment, StatefulSet...)
+// so the matching and patching logic doesn't have to care about its kind
+type Workload struct {
+	client.Object
+	Kind        rookoutv1alpha1.WorkloadKind
+	PodTemplate *core.PodTemplateSpec
+	// Labels of the workload's namespace, only set when a configuration uses a namespace selector
+	NamespaceLabels map[string]string
+}
+
+func newWorkloadObject(kind rookoutv1alpha1.WorkloadKind) (client.Object, error) {
+	switch kind {
+	case rookoutv1alpha1.DeploymentKind:
+		return &apps.Deployment{}, nil
+	case rookoutv1alpha1.StatefulSetKind:
+		return &apps.StatefulSet{}, nil
+	case rookoutv1alpha1.DaemonSetKind:
+		return &apps.DaemonSet{}, nil
+	case rookoutv1alpha1.CronJobKind:
+		return &batchv1beta1.CronJob{}, nil
+	case rookoutv1alpha1.JobKind:
+		return &batch.Job{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported workload kind %s", kind)
+}
+
+func newWorkloadList(kind rookoutv1alpha1.WorkloadKind) (client.ObjectList, error) {
+	switch kind {
+	case rookoutv1alpha1.DeploymentKind:
+		return &apps.DeploymentList{}, nil
+	case rookoutv1alpha1.StatefulSetKind:
+		return &apps.StatefulSetList{}, nil
+	case rookoutv1alpha1.DaemonSetKind:
+		return &apps.DaemonSetList{}, nil
+	case rookoutv1alpha1.CronJobKind:
+		return &batchv1beta1.CronJobList{}, nil
+	case rookoutv1alpha1.JobKind:
+		return &batch.JobList{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported workload kind %s", kind)
+}
+
+func newWorkload(obj client.Object) (*Workload, error) {
+	switch typed := obj.(type) {
+	case *apps.Deployment:
+		return &Workload{Object: typed, Kind: rookoutv1alpha1.DeploymentKind, PodTemplate: &typed.Spec.Template}, nil
+	case *apps.StatefulSet:
+		return &Workload{Object: typed, Kind: rookoutv1alpha1.StatefulSetKind, PodTemplate: &typed.Spec.Template}, nil
+	case *apps.DaemonSet:
+		return &Workload{Object: typed, Kind: rookoutv1alpha1.DaemonSetKind, PodTemplate: &typed.Spec.Template}, nil
+	case *batchv1beta1.CronJob:
+		// Only future runs are affected, jobs already created by the cronjob keep their template
+		return &Workload{Object: typed, Kind: rookoutv1alpha1.CronJobKind, PodTemplate: &typed.Spec.JobTemplate.Spec.Template}, nil
+	case *batch.Job:
+		return &Workload{Object: typed, Kind: rookoutv1alpha1.JobKind, PodTemplate: &typed.Spec.Template}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported workload type %T", obj)
+}
+
+// Reads the labels of the workload's namespace, only when a ready configuration uses a namespace selector
+func setNamespaceLabels(ctx context.Context, reader client.Reader, workload *Workload) error {
+	if !configurations.UsesNamespaceSelector() {
+		return nil
+	}
+
+	namespace := &core.Namespace{}
+	err := reader.Get(ctx, types.NamespacedName{Name: workload.GetNamespace()}, namespace)
+	if err != nil {
+		return err
+	}
+
+	workload.NamespaceLabels = namespace.Labels
+	return nil
+}
+
+func (w *Workload) DeepCopy() *Workload {
+	workload, _ := newWorkload(w.Object.DeepCopyObject().(client.Object))
+	workload.NamespaceLabels = w.NamespaceLabels
+	return workload
+}
+
+func (w *Workload) NamespacedName() types.NamespacedName {
+	return types.NamespacedName{Namespace: w.GetNamespace(), Name: w.GetName()}
+}
+
+// Changing the pod template of a DaemonSet restarts a pod on every node, we never force that rollout
+// and let the DaemonSet's updateStrategy decide when its pods pick up (or drop) the agent
+func (w *Workload) rolloutDescription() string {
+	switch w.Kind {
+	case rookoutv1alpha1.CronJobKind:
+		return "next jobs will be created with the new template"
+	case rookoutv1alpha1.JobKind:
+		return "job pods are created with the new template"
+	}
+
+	daemonSet, ok := w.Object.(*apps.DaemonSet)
+	if !ok {
+		return "pods will be rolled out"
+	}
+
+	if daemonSet.Spec.UpdateStrategy.Type == apps.OnDeleteDaemonSetStrategyType {
+		return "daemonset uses OnDelete update strategy, existing pods will be updated only when they are deleted"
+	}
+
+	maxUnavailable := "1"
+	if daemonSet.Spec.UpdateStrategy.RollingUpdate != nil && daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable != nil {
+		maxUnavailable = daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable.String()
+	}
+
+	return fmt.Sprintf("daemonset pods will be rolled out on every node, %s unavailable at a time", maxUnavailable)
+}
+
+func (w *Workload) String() string {
+	return fmt.Sprintf("%s %s", w.Kind, w.NamespacedName())
+}
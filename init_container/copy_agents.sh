@@ -0,0 +1,6 @@
+#!/bin/sh
+# Copies the agents to the volume shared with the application containers
+set -e
+
+cp -r /agents/java/. /rookout/
+cp -r /agents/python /agents/node /agents/dotnet /rookout/
@@ -0,0 +1,22 @@
+// Preloaded by the rookout operator through NODE_OPTIONS. The agent's native modules are built against either glibc
+// (Debian based images) or musl (Alpine images), so we start the build matching the container's libc
+const path = require('path');
+
+function detectLibc() {
+  // Older node versions have no process report, most images are glibc based
+  if (!process.report) {
+    return 'glibc';
+  }
+
+  try {
+    return process.report.getReport().header.glibcVersionRuntime ? 'glibc' : 'musl';
+  } catch (e) {
+    return 'glibc';
+  }
+}
+
+try {
+  require(path.join(__dirname, detectLibc(), 'node_modules', 'rookout', 'auto_start.js'));
+} catch (e) {
+  process.stderr.write(`[Rookout] Failed to start the agent: ${e}\n`);
+}
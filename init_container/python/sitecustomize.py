@@ -0,0 +1,31 @@
+# Imported by python on startup, since the rookout operator adds this directory to PYTHONPATH. The directory only holds
+# this module, rook and its dependencies are built per Python version and libc under site/
+import os
+import platform
+import sys
+
+_rookout_dir = os.path.dirname(os.path.abspath(__file__))
+_libc = "glibc" if platform.libc_ver()[0] == "glibc" else "musl"
+_site_dir = os.path.join(_rookout_dir, "site", "cp%d%d-%s" % (sys.version_info[0], sys.version_info[1], _libc))
+
+if os.path.isdir(_site_dir):
+    # Appended, so the application's own versions of rook's dependencies take precedence
+    sys.path.append(_site_dir)
+    try:
+        import rook
+        rook.start()
+    except Exception as e:
+        sys.stderr.write("[Rookout] Failed to start rook: %s\n" % e)
+else:
+    sys.stderr.write("[Rookout] rook isn't available for Python %d.%d (%s), not starting it\n" % (sys.version_info[0], sys.version_info[1], _libc))
+
+# Chaining to the application's own sitecustomize (if any), which we are shadowing
+_original_path = sys.path[:]
+try:
+    sys.path = [p for p in sys.path if os.path.abspath(p or ".") != _rookout_dir]
+    del sys.modules["sitecustomize"]
+    import sitecustomize  # noqa: F401
+except ImportError:
+    pass
+finally:
+    sys.path = _original_path
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -28,6 +29,7 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -52,11 +54,25 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var namespaces string
+	var clusterScopeNamespaces string
+	var maxConcurrentReconciles int
+	var dryRun bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&namespaces, "namespaces", "",
+		"Comma separated list of namespaces the operator is restricted to (all namespaces when empty). "+
+			"In this mode every Rookout configuration only applies to workloads in its own namespace.")
+	flag.StringVar(&clusterScopeNamespaces, "cluster-scope-namespaces", "rookout",
+		"Comma separated list of namespaces whose Rookout configurations may use the Cluster scope (instrument every namespace). "+
+			"Configurations elsewhere only apply to their own namespace.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Maximum number of configurations and of workloads of each kind reconciled concurrently.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Never patch workloads, report the patches the operator would send in the status of the configurations.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,28 +81,56 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "12f6aaf3.rookout.com",
-	})
+	}
+
+	watchNamespaces := splitNamespaces(namespaces)
+
+	// Only watching (and caching) the given namespaces, so the operator only needs permissions in them
+	if len(watchNamespaces) == 1 {
+		options.Namespace = watchNamespaces[0]
+	} else if len(watchNamespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(watchNamespaces)
+	}
+	if len(watchNamespaces) > 0 {
+		setupLog.Info("operator is restricted to namespaces", "namespaces", watchNamespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.RookoutReconciler{
-		Client:             mgr.GetClient(),
-		Log:                ctrl.Log.WithName("controllers").WithName("Rookout"),
-		Scheme:             mgr.GetScheme(),
-		DeploymentsManager: controllers.NewDeploymentsManager(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("Rookout"),
+		Scheme:                  mgr.GetScheme(),
+		DeploymentsManager:      controllers.NewDeploymentsManager(),
+		Namespaces:              watchNamespaces,
+		ClusterScopeNamespaces:  splitNamespaces(clusterScopeNamespaces),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		DryRun:                  dryRun,
+		APIReader:               mgr.GetAPIReader(),
+		Recorder:                mgr.GetEventRecorderFor("rookout-operator"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Rookout")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		controllers.SetupWebhooksWithManager(mgr)
+
+		if err = (&rookoutv1alpha1.Rookout{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Rookout")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
@@ -104,3 +148,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func splitNamespaces(namespaces string) []string {
+	var split []string
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			split = append(split, namespace)
+		}
+	}
+
+	return split
+}